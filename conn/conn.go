@@ -83,3 +83,18 @@ type Limits interface {
 	// Returns 0 if undefined.
 	MaxTxSize() int
 }
+
+// Resource is a generic resource that can be released, like a device, a pin
+// expander or a bus.
+//
+// It is meant to be used by code that manages the lifecycle of resources
+// without knowing their concrete type.
+type Resource interface {
+	// String returns a human readable identifier representing this resource.
+	fmt.Stringer
+	// Halt stops the resource and puts it in a safe state.
+	//
+	// Unlike a connection, a resource doesn't have to be closed. What halting
+	// entails depends on the resource.
+	Halt() error
+}
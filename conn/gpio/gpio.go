@@ -236,6 +236,26 @@ type PinDefaultPull interface {
 	DefaultPull() Pull
 }
 
+// GPIOValue is a bit field of pin levels for a Group.
+//
+// Bit 0 is the first pin of the group.
+type GPIOValue uint64
+
+// Group is a set of pins that can be driven and read together.
+//
+// This is more efficient than accessing the pins one by one when the
+// underlying hardware exposes them as a port, like an I/O expander.
+type Group interface {
+	// Out sets the pins selected by mask to the corresponding bit in values.
+	//
+	// The pins not selected by mask are left untouched.
+	Out(mask, values GPIOValue) error
+	// Read returns the level of the pins selected by mask.
+	//
+	// The bits not selected by mask are 0.
+	Read(mask GPIOValue) (GPIOValue, error)
+}
+
 // INVALID implements PinIO and fails on all access.
 var INVALID PinIO
 
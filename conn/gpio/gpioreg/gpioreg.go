@@ -137,6 +137,36 @@ func Register(p gpio.PinIO, preferred bool) error {
 	return nil
 }
 
+// Unregister removes a previously registered GPIO pin from the registry.
+//
+// This is useful for pins exposed by a device that can go away, like an I²C
+// I/O expander. Aliases pointing to the pin are kept but are unresolved again.
+func Unregister(name string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	found := false
+	for i := range byName {
+		p, ok := byName[i][name]
+		if !ok {
+			continue
+		}
+		found = true
+		delete(byName[i], name)
+		if byNumber[i][p.Number()] == p {
+			delete(byNumber[i], p.Number())
+		}
+		for _, a := range byAlias {
+			if a.PinIO == p {
+				a.PinIO = nil
+			}
+		}
+	}
+	if !found {
+		return wrapf("can't unregister unknown pin name %q", name)
+	}
+	return nil
+}
+
 // RegisterAlias registers an alias for a GPIO pin.
 //
 // It is possible to register an alias for a pin that itself has not been
@@ -162,6 +192,44 @@ func RegisterAlias(alias string, dest string) error {
 	return nil
 }
 
+// GroupByName returns a group of GPIO pins registered with RegisterGroup.
+//
+// Returns nil in case the group is not present.
+func GroupByName(name string) gpio.Group {
+	mu.Lock()
+	defer mu.Unlock()
+	return byGroup[name]
+}
+
+// RegisterGroup registers a group of GPIO pins, e.g. all the pins of an I/O
+// expander, so it can be retrieved as a unit with GroupByName.
+//
+// Registering the same group name twice is an error. The pins of the group
+// are registered independently with Register.
+func RegisterGroup(name string, g gpio.Group) error {
+	if len(name) == 0 {
+		return wrapf("can't register a group with no name")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := byGroup[name]; ok {
+		return wrapf("can't register group %q twice", name)
+	}
+	byGroup[name] = g
+	return nil
+}
+
+// UnregisterGroup removes a group previously registered with RegisterGroup.
+func UnregisterGroup(name string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := byGroup[name]; !ok {
+		return wrapf("can't unregister unknown group name %q", name)
+	}
+	delete(byGroup, name)
+	return nil
+}
+
 //
 
 var (
@@ -171,6 +239,7 @@ var (
 	byNumber = [2]map[int]gpio.PinIO{{}, {}}
 	byName   = [2]map[string]gpio.PinIO{{}, {}}
 	byAlias  = map[string]*pinAlias{}
+	byGroup  = map[string]gpio.Group{}
 )
 
 // pinAlias implements an alias for a PinIO.
@@ -121,6 +121,34 @@ func TestRegister_fail(t *testing.T) {
 	}
 }
 
+func TestUnregister(t *testing.T) {
+	defer reset()
+	if err := Register(&basicPin{PinIO: gpio.INVALID, name: "a", num: 0}, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterAlias("z", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if ByName("z") == nil {
+		t.Fatal("failed to resolve alias 'z'")
+	}
+	if err := Unregister("a"); err != nil {
+		t.Fatal(err)
+	}
+	if ByName("a") != nil || ByNumber(0) != nil {
+		t.Fatal("pin 'a' was unregistered")
+	}
+	if ByName("z") != nil {
+		t.Fatal("alias 'z' shouldn't resolve anymore")
+	}
+	if err := Unregister("a"); err == nil {
+		t.Fatal("pin 'a' is not registered")
+	}
+	if err := Register(&basicPin{PinIO: gpio.INVALID, name: "a", num: 0}, true); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestRegisterAlias(t *testing.T) {
 	defer reset()
 	if err := RegisterAlias("alias0", "GPIO0"); err != nil {
@@ -186,6 +214,35 @@ func TestRegisterAlias_fail(t *testing.T) {
 	}
 }
 
+func TestRegisterGroup(t *testing.T) {
+	defer reset()
+	if err := RegisterGroup("", &basicGroup{}); err == nil {
+		t.Fatal("group with no name")
+	}
+	g := &basicGroup{}
+	if err := RegisterGroup("g", g); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterGroup("g", &basicGroup{}); err == nil {
+		t.Fatal("group 'g' is already registered")
+	}
+	if GroupByName("g") != g {
+		t.Fatal("failed to get group 'g'")
+	}
+	if GroupByName("h") != nil {
+		t.Fatal("there is no group 'h'")
+	}
+	if err := UnregisterGroup("g"); err != nil {
+		t.Fatal(err)
+	}
+	if GroupByName("g") != nil {
+		t.Fatal("group 'g' was unregistered")
+	}
+	if err := UnregisterGroup("g"); err == nil {
+		t.Fatal("group 'g' is not registered")
+	}
+}
+
 func TestPinList(t *testing.T) {
 	l := pinList{&basicPin{PinIO: gpio.INVALID, num: 1}, &basicPin{PinIO: gpio.INVALID}}
 	sort.Sort(l)
@@ -215,10 +272,22 @@ func (b *basicPin) Number() int {
 	return b.num
 }
 
+// basicGroup implements gpio.Group as a non-functional group.
+type basicGroup struct{}
+
+func (b *basicGroup) Out(mask, values gpio.GPIOValue) error {
+	return nil
+}
+
+func (b *basicGroup) Read(mask gpio.GPIOValue) (gpio.GPIOValue, error) {
+	return 0, nil
+}
+
 func reset() {
 	mu.Lock()
 	defer mu.Unlock()
 	byNumber = [2]map[int]gpio.PinIO{{}, {}}
 	byName = [2]map[string]gpio.PinIO{{}, {}}
 	byAlias = map[string]*pinAlias{}
+	byGroup = map[string]gpio.Group{}
 }
@@ -0,0 +1,95 @@
+// Copyright 2017 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package pcf857x contains the logic shared by the PCF8574 and PCF8575
+// drivers.
+//
+// Both chips have quasi-bidirectional ports without any register: a write
+// sets the output latch of all the pins, a read returns the level of all the
+// pins. The only difference is the number of pins, 8 or 16.
+package pcf857x
+
+import "errors"
+
+// ErrPinRange is returned when a pin index is out of range.
+var ErrPinRange = errors.New("pin index out of range")
+
+// Port is the cached output latch of a port.
+//
+// Pin 0 is bit 0 of the first byte, pin 8 is bit 0 of the second byte.
+type Port struct {
+	State []byte // One byte per 8 pins, in the order used on the wire
+}
+
+// NewPort returns a Port of n pins, all latched high as on power-on.
+//
+// n must be a multiple of 8.
+func NewPort(n int) Port {
+	p := Port{State: make([]byte, n/8)}
+	p.SetWord(0xffff)
+	return p
+}
+
+// Pins returns the number of pins.
+func (p *Port) Pins() int {
+	return 8 * len(p.State)
+}
+
+// Valid returns true if index is a valid pin index.
+func (p *Port) Valid(index int) bool {
+	return index >= 0 && index < p.Pins()
+}
+
+// Get returns the cached output of the pin at index.
+func (p *Port) Get(index int) bool {
+	return GetBit(p.State[index/8], index%8)
+}
+
+// Set sets the cached output of the pin at index.
+func (p *Port) Set(index int, state bool) {
+	p.State[index/8] = SetBit(p.State[index/8], index%8, state)
+}
+
+// Word returns the cached output of all the pins, bit 0 being pin 0.
+func (p *Port) Word() uint16 {
+	return Word(p.State)
+}
+
+// SetWord sets the cached output of all the pins, bit 0 being pin 0.
+//
+// The bits above the number of pins are ignored.
+func (p *Port) SetWord(w uint16) {
+	for i := range p.State {
+		p.State[i] = byte(w >> uint(8*i))
+	}
+}
+
+// Word decodes the bytes read from the wire, bit 0 being pin 0.
+func Word(b []byte) uint16 {
+	var w uint16
+	for i, v := range b {
+		w |= uint16(v) << uint(8*i)
+	}
+	return w
+}
+
+// SetBit returns value with the bit at index set to state.
+func SetBit(value byte, index int, state bool) byte {
+	if state {
+		return value | GetMask(index)
+	}
+	return value & ^GetMask(index)
+}
+
+// GetBit returns the bit at index of value.
+func GetBit(value byte, index int) bool {
+	return value&GetMask(index) > 0
+}
+
+// GetMask returns the mask for the bit at index.
+//
+// It returns 0 if index is not between 0 and 7.
+func GetMask(index int) byte {
+	return byte(1) << uint(index)
+}
@@ -0,0 +1,88 @@
+// Copyright 2017 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package pcf857x
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPort(t *testing.T) {
+	p := NewPort(16)
+	if n := p.Pins(); n != 16 {
+		t.Fatal(n)
+	}
+	if p.Valid(-1) || !p.Valid(0) || !p.Valid(15) || p.Valid(16) {
+		t.Fatal("Valid")
+	}
+	if w := p.Word(); w != 0xffff {
+		t.Fatalf("%#x", w)
+	}
+	p.Set(0, false)
+	p.Set(9, false)
+	if !bytes.Equal(p.State, []byte{0xfe, 0xfd}) {
+		t.Fatalf("%#v", p.State)
+	}
+	if p.Get(0) || !p.Get(1) || p.Get(9) {
+		t.Fatal("Get")
+	}
+	p.SetWord(0x1234)
+	if !bytes.Equal(p.State, []byte{0x34, 0x12}) {
+		t.Fatalf("%#v", p.State)
+	}
+}
+
+func TestPort_8(t *testing.T) {
+	p := NewPort(8)
+	if n := p.Pins(); n != 8 {
+		t.Fatal(n)
+	}
+	if p.Valid(8) {
+		t.Fatal("Valid")
+	}
+	p.SetWord(0x1234)
+	if w := p.Word(); w != 0x34 {
+		t.Fatalf("%#x", w)
+	}
+}
+
+func TestWord(t *testing.T) {
+	if w := Word([]byte{0x34, 0x12}); w != 0x1234 {
+		t.Fatalf("%#x", w)
+	}
+	if w := Word([]byte{0x34}); w != 0x34 {
+		t.Fatalf("%#x", w)
+	}
+}
+
+func FuzzSetBit(f *testing.F) {
+	f.Add(byte(0xff), 0, false)
+	f.Add(byte(0x00), 7, true)
+	f.Add(byte(0x5a), 8, true)
+	f.Add(byte(0xa5), -1, false)
+	f.Add(byte(0x00), 259, true)
+	f.Fuzz(func(t *testing.T, value byte, index int, state bool) {
+		v := SetBit(value, index, state)
+		if index < 0 || index > 7 {
+			// Out of range indexes are ignored.
+			if GetMask(index) != 0 || v != value || GetBit(value, index) {
+				t.Fatalf("SetBit(%#x, %d, %t) = %#x", value, index, state, v)
+			}
+			return
+		}
+		if m := GetMask(index); m != 1<<uint(index) {
+			t.Fatalf("GetMask(%d) = %#x", index, m)
+		}
+		if GetBit(v, index) != state {
+			t.Fatalf("SetBit(%#x, %d, %t) = %#x", value, index, state, v)
+		}
+		if d := v ^ value; d&^GetMask(index) != 0 {
+			t.Fatalf("SetBit(%#x, %d, %t) = %#x changed other bits", value, index, state, v)
+		}
+		if SetBit(v, index, GetBit(value, index)) != value {
+			t.Fatalf("SetBit(%#x, %d, %t) = %#x doesn't round trip", value, index, state, v)
+		}
+	})
+}
@@ -0,0 +1,147 @@
+// Copyright 2017 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package pcf8574 controls a Texas Instruments PCF8574 device over I²C.
+//
+// The PCF8574 is the 8 pins version of the PCF8575, see package pcf8575 for
+// the 16 pins version. The API is the same, this package only exposes pins 0
+// to 7. It is commonly used as the I²C backpack of HD44780 character LCDs.
+//
+// Datasheet
+//
+// http://www.ti.com/lit/ds/symlink/pcf8574.pdf
+package pcf8574
+
+import (
+	"fmt"
+	"sync"
+
+	"periph.io/x/periph/conn"
+	"periph.io/x/periph/conn/i2c"
+	"periph.io/x/periph/devices"
+	"periph.io/x/periph/devices/internal/pcf857x"
+)
+
+// ErrPinRange is returned when a pin index is not between 0 and 7.
+//
+// It is the same error as pcf8575.ErrPinRange.
+var ErrPinRange = pcf857x.ErrPinRange
+
+// New returns an object that communicates over I²C to a PCF8574 I/O expander.
+//
+// The address is between 0x20 and 0x27 for the PCF8574 and between 0x38 and
+// 0x3F for the PCF8574A.
+//
+// All outputs are initialized as high (the device's default power-on state).
+func New(i i2c.Bus, addr uint16) (*Dev, error) {
+	d := &Dev{c: &i2c.Dev{Bus: i, Addr: addr}, port: pcf857x.NewPort(8)}
+	if err := d.updateState(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Dev is a handle to a pcf8574.
+type Dev struct {
+	c conn.Conn // Connection
+
+	mu   sync.Mutex
+	port pcf857x.Port // Cached state of the outputs
+}
+
+func (d *Dev) String() string {
+	return fmt.Sprintf("PCF8574{%s}", d.c)
+}
+
+// Halt implements devices.Device.
+func (d *Dev) Halt() error {
+	return nil
+}
+
+// WriteOutput sets the output of the pin at index, between 0 and 7.
+func (d *Dev) WriteOutput(index int, state bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.port.Valid(index) {
+		return fmt.Errorf("PCF8574.WriteOutput: %w (%d)", ErrPinRange, index)
+	}
+	d.port.Set(index, state)
+	return d.updateState()
+}
+
+// WriteAll sets all 8 outputs in a single I²C transaction.
+//
+// Bit 0 is P0 and bit 7 is P7. The upper byte is ignored, so the same values
+// can be used with a pcf8575.Dev.
+func (d *Dev) WriteAll(state uint16) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.port.SetWord(state)
+	return d.updateState()
+}
+
+// WriteMask sets the outputs selected by mask to the corresponding bits in
+// values in a single I²C transaction, leaving the other outputs unchanged.
+//
+// The bit ordering is the same as WriteAll.
+func (d *Dev) WriteMask(mask, values uint16) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.port.SetWord(d.port.Word()&^mask | values&mask)
+	return d.updateState()
+}
+
+// ReadOutput returns the cached output of the pin at index.
+func (d *Dev) ReadOutput(index int) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.port.Valid(index) {
+		return false, fmt.Errorf("PCF8574.ReadOutput: %w (%d)", ErrPinRange, index)
+	}
+	return d.port.Get(index), nil
+}
+
+// ReadInput reads the level of the pin at index.
+func (d *Dev) ReadInput(index int) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.port.Valid(index) {
+		return false, fmt.Errorf("PCF8574.ReadInput: %w (%d)", ErrPinRange, index)
+	}
+	s, err := d.readState()
+	if err != nil {
+		return false, err
+	}
+	return pcf857x.GetBit(s[0], index), nil
+}
+
+// ReadAll reads the level of all 8 pins in a single I²C transaction.
+//
+// The bit ordering is the same as WriteAll, the upper byte is always 0.
+func (d *Dev) ReadAll() (uint16, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s, err := d.readState()
+	if err != nil {
+		return 0, err
+	}
+	return pcf857x.Word(s), nil
+}
+
+func (d *Dev) readState() ([]byte, error) {
+	s := []byte{0}
+	if err := d.c.Tx(nil, s); err != nil {
+		return s, fmt.Errorf("pcf8574: read input: %w", err)
+	}
+	return s, nil
+}
+
+func (d *Dev) updateState() error {
+	if err := d.c.Tx(d.port.State, nil); err != nil {
+		return fmt.Errorf("pcf8574: write output: %w", err)
+	}
+	return nil
+}
+
+var _ devices.Device = &Dev{}
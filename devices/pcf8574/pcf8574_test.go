@@ -0,0 +1,66 @@
+// Copyright 2017 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package pcf8574
+
+import (
+	"errors"
+	"testing"
+
+	"periph.io/x/periph/conn/i2c/i2ctest"
+)
+
+func TestDev(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x27, W: []byte{0xff}},
+			{Addr: 0x27, W: []byte{0xf7}},
+			{Addr: 0x27, W: []byte{0x34}},
+			{Addr: 0x27, R: []byte{0x81}},
+			{Addr: 0x27, R: []byte{0x81}},
+			{Addr: 0x27, W: []byte{0x3c}},
+		},
+	}
+	d, err := New(&bus, 0x27)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := d.String(); s != "PCF8574{playback(39)}" {
+		t.Fatal(s)
+	}
+	if err := d.WriteOutput(3, false); err != nil {
+		t.Fatal(err)
+	}
+	if l, err := d.ReadOutput(3); l || err != nil {
+		t.Fatal(l, err)
+	}
+	if err := d.WriteAll(0x1234); err != nil {
+		t.Fatal(err)
+	}
+	if l, err := d.ReadInput(7); !l || err != nil {
+		t.Fatal(l, err)
+	}
+	if v, err := d.ReadAll(); v != 0x81 || err != nil {
+		t.Fatal(v, err)
+	}
+	if err := d.WriteMask(0x0f08, 0xff08); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteOutput(8, false); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if _, err := d.ReadOutput(8); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	// No I/O for an invalid pin.
+	if _, err := d.ReadInput(8); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2017 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package pcf8575
+
+import "time"
+
+// Backoff computes the delays between the attempts set with WithRetry.
+//
+// It is set with WithBackoff.
+type Backoff interface {
+	// Delay returns the delay before the retry, 1 being the first retry, i.e.
+	// the second attempt.
+	Delay(retry int) time.Duration
+}
+
+// ConstantBackoff waits the same delay before each retry.
+type ConstantBackoff time.Duration
+
+// Delay implements Backoff.
+func (c ConstantBackoff) Delay(retry int) time.Duration {
+	return time.Duration(c)
+}
+
+// LinearBackoff waits retry times the delay before each retry, e.g. 1ms, 2ms,
+// 3ms.
+type LinearBackoff time.Duration
+
+// Delay implements Backoff.
+func (l LinearBackoff) Delay(retry int) time.Duration {
+	return time.Duration(retry) * time.Duration(l)
+}
+
+// ExponentialBackoff waits Initial before the first retry and doubles the
+// delay for each following retry, up to Max.
+//
+// It is the Backoff used by WithRetry.
+type ExponentialBackoff struct {
+	Initial time.Duration
+	Max     time.Duration // Maximum delay; 0 for no maximum
+}
+
+// Delay implements Backoff.
+func (e ExponentialBackoff) Delay(retry int) time.Duration {
+	d := e.Initial
+	for i := 1; i < retry && d > 0; i++ {
+		if e.Max > 0 && d >= e.Max {
+			break
+		}
+		if d > maxDuration/2 {
+			// Don't overflow on a large number of attempts.
+			d = maxDuration
+			break
+		}
+		d *= 2
+	}
+	if e.Max > 0 && d > e.Max {
+		return e.Max
+	}
+	return d
+}
+
+//
+
+const maxDuration = time.Duration(1<<63 - 1)
+
+var _ Backoff = ConstantBackoff(0)
+var _ Backoff = LinearBackoff(0)
+var _ Backoff = ExponentialBackoff{}
@@ -0,0 +1,76 @@
+// Copyright 2017 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package pcf8575
+
+import (
+	"fmt"
+
+	"periph.io/x/periph/devices"
+)
+
+// BargraphMode is how a Bargraph displays a level.
+type BargraphMode int
+
+// Valid BargraphMode.
+const (
+	// BarMode lights all the LEDs up to the level.
+	BarMode BargraphMode = iota
+	// DotMode only lights the LED at the level.
+	DotMode
+)
+
+// Bargraph drives a row of LEDs connected to consecutive pins, e.g. a level
+// indicator.
+//
+// A LED is lit when its pin is latched high. The pins can't source enough
+// current to light a LED wired to ground, see Dev.CanSourceCurrent: wire the
+// LEDs between VDD and the pins and use Dev.SetInverted.
+type Bargraph struct {
+	p     Expander
+	start int
+	n     int
+	mode  BargraphMode
+	mask  uint16
+}
+
+// NewBargraph returns a Bargraph of n LEDs connected to the pins start to
+// start+n-1, start being the first LED lit.
+//
+// It doesn't do any I/O.
+func NewBargraph(p Expander, start, n int, mode BargraphMode) (*Bargraph, error) {
+	if start < 0 || n < 1 || start+n > PinCount {
+		return nil, fmt.Errorf("pcf8575: bargraph pins %w (%d, %d LEDs)", ErrPinRange, start, n)
+	}
+	if mode != BarMode && mode != DotMode {
+		return nil, fmt.Errorf("pcf8575: invalid bargraph mode %d", mode)
+	}
+	return &Bargraph{p: p, start: start, n: n, mode: mode, mask: uint16((uint32(1)<<uint(n) - 1) << uint(start))}, nil
+}
+
+func (b *Bargraph) String() string {
+	return fmt.Sprintf("Bargraph{%s}", b.p)
+}
+
+// Set displays level, between 0 (all LEDs off) and the number of LEDs, in a
+// single write.
+func (b *Bargraph) Set(level int) error {
+	if level < 0 || level > b.n {
+		return fmt.Errorf("pcf8575: invalid bargraph level %d", level)
+	}
+	var v uint16
+	if b.mode == BarMode {
+		v = uint16(uint32(1)<<uint(level)-1) << uint(b.start)
+	} else if level != 0 {
+		v = 1 << uint(b.start+level-1)
+	}
+	return b.p.WriteMask(b.mask, v)
+}
+
+// Halt turns all the LEDs off.
+func (b *Bargraph) Halt() error {
+	return b.Set(0)
+}
+
+var _ devices.Device = &Bargraph{}
@@ -0,0 +1,118 @@
+// Copyright 2017 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package pcf8575
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"periph.io/x/periph/conn/gpio"
+	"periph.io/x/periph/devices"
+)
+
+// Chain presents multiple PCF8575 as a single wide port.
+//
+// The pin indexes are flat: 0 to 15 are the pins of the first device, 16 to
+// 31 the pins of the second device, and so on.
+type Chain struct {
+	devs []*Dev
+}
+
+// NewChain returns a Chain of devs, in order.
+func NewChain(devs ...*Dev) (*Chain, error) {
+	if len(devs) == 0 {
+		return nil, errors.New("pcf8575: empty chain")
+	}
+	for _, d := range devs {
+		if d == nil {
+			return nil, errors.New("pcf8575: nil device in chain")
+		}
+	}
+	return &Chain{devs: append([]*Dev(nil), devs...)}, nil
+}
+
+func (c *Chain) String() string {
+	s := make([]string, len(c.devs))
+	for i, d := range c.devs {
+		s[i] = d.String()
+	}
+	return "PCF8575Chain{" + strings.Join(s, ", ") + "}"
+}
+
+// Halt halts all the devices and returns the first error.
+func (c *Chain) Halt() error {
+	var err error
+	for _, d := range c.devs {
+		if err1 := d.Halt(); err == nil {
+			err = err1
+		}
+	}
+	return err
+}
+
+// Len returns the number of pins in the chain.
+func (c *Chain) Len() int {
+	return PinCount * len(c.devs)
+}
+
+// Pin returns the gpio.PinIO for the pin at index.
+//
+// Returns gpio.INVALID if index is out of range.
+func (c *Chain) Pin(index int) gpio.PinIO {
+	d, i, ok := c.route(index)
+	if !ok {
+		return gpio.INVALID
+	}
+	return d.Pin(i)
+}
+
+// Pins returns the gpio.PinIO for all the pins of the chain in order.
+func (c *Chain) Pins() []gpio.PinIO {
+	out := make([]gpio.PinIO, 0, c.Len())
+	for _, d := range c.devs {
+		out = append(out, d.Pins()...)
+	}
+	return out
+}
+
+// WriteOutput sets the output of the pin at index.
+func (c *Chain) WriteOutput(index int, state bool) error {
+	d, i, ok := c.route(index)
+	if !ok {
+		return fmt.Errorf("PCF8575Chain.WriteOutput: %w (%d)", ErrPinRange, index)
+	}
+	return d.WriteOutput(i, state)
+}
+
+// ReadOutput returns the cached output of the pin at index.
+func (c *Chain) ReadOutput(index int) (bool, error) {
+	d, i, ok := c.route(index)
+	if !ok {
+		return false, fmt.Errorf("PCF8575Chain.ReadOutput: %w (%d)", ErrPinRange, index)
+	}
+	return d.ReadOutput(i)
+}
+
+// ReadInput reads the level of the pin at index.
+//
+// See Dev.ReadInput for the quasi-bidirectional semantics.
+func (c *Chain) ReadInput(index int) (bool, error) {
+	d, i, ok := c.route(index)
+	if !ok {
+		return false, fmt.Errorf("PCF8575Chain.ReadInput: %w (%d)", ErrPinRange, index)
+	}
+	return d.readPin(i)
+}
+
+// route returns the device and its pin index for the flat index.
+func (c *Chain) route(index int) (*Dev, int, bool) {
+	if index < 0 || index >= c.Len() {
+		return nil, 0, false
+	}
+	return c.devs[index/PinCount], index % PinCount, true
+}
+
+var _ devices.Device = &Chain{}
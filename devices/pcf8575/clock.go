@@ -0,0 +1,41 @@
+// Copyright 2017 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package pcf8575
+
+import "time"
+
+// Clock is the time source used for the timing of PWM, WithPinRateLimit, LCD
+// and Stepper, e.g. to test code using them without real delays.
+//
+// It is set with WithClock, LCD.SetClock and Stepper.SetClock. The default is
+// the wall clock of the time package.
+type Clock interface {
+	// Now returns the current time, like time.Now.
+	Now() time.Time
+	// Sleep waits for d, like time.Sleep.
+	Sleep(d time.Duration)
+	// After returns a channel receiving the time once d elapsed, like
+	// time.After.
+	After(d time.Duration) <-chan time.Time
+}
+
+//
+
+// wallClock is the default Clock.
+type wallClock struct{}
+
+func (wallClock) Now() time.Time {
+	return time.Now()
+}
+
+func (wallClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func (wallClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+var _ Clock = wallClock{}
@@ -0,0 +1,52 @@
+// Copyright 2017 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package pcf8575
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrUnstable is returned by ReadInputDebounced when the pin didn't settle
+// before the timeout.
+var ErrUnstable = errors.New("pin didn't settle")
+
+// ReadInputDebounced reads the level of the pin at index once it has been
+// stable for window.
+//
+// The pin is sampled with ReadInput, one I²C transaction per sample, at the
+// interval set with WithDebounceSampling. If the pin doesn't settle before the
+// timeout set with WithDebounceSampling, the last level read is returned along
+// ErrUnstable.
+func (d *Dev) ReadInputDebounced(index int, window time.Duration) (bool, error) {
+	if !d.port.Valid(index) {
+		return false, fmt.Errorf("PCF8575.ReadInputDebounced: %w (%d)", ErrPinRange, index)
+	}
+	start := time.Now()
+	l, err := d.readPin(index)
+	if err != nil {
+		return l, err
+	}
+	since := start
+	for {
+		now := time.Now()
+		if now.Sub(since) >= window {
+			return l, nil
+		}
+		if now.Sub(start) >= d.debounceTimeout {
+			return l, fmt.Errorf("PCF8575.ReadInputDebounced: %w (%d)", ErrUnstable, index)
+		}
+		time.Sleep(d.debounceInterval)
+		n, err := d.readPin(index)
+		if err != nil {
+			return n, err
+		}
+		if n != l {
+			l = n
+			since = time.Now()
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2017 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package pcf8575
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"periph.io/x/periph/devices"
+)
+
+// Encoder reads a quadrature rotary encoder connected to two pins.
+//
+// The pins are read when the INT pin signals a change if WithInterruptPin was
+// used, otherwise periodically at the interval set with WithPollInterval.
+//
+// The position is counted in quarter steps: most detented encoders move by 4
+// per detent. The transitions are decoded with the gray code state machine,
+// so a bounce on one line counts one step forward then one step backward and
+// doesn't change the position. A transition where both lines changed between
+// two reads is ignored.
+type Encoder struct {
+	d       *Dev
+	a, b    int
+	changed chan int
+	quit    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+
+	mu  sync.Mutex
+	pos int
+	err error
+}
+
+// encoderSteps is indexed by previous state << 2 | new state, with a state
+// being A | B << 1.
+var encoderSteps = [16]int{0, 1, -1, 0, -1, 0, 0, 1, 1, 0, 0, -1, 0, -1, 1, 0}
+
+// NewEncoder starts reading the encoder whose A and B outputs are connected to
+// the pins a and b. Both pins are latched high.
+//
+// Call Halt to stop reading.
+func NewEncoder(d *Dev, a, b int) (*Encoder, error) {
+	for _, i := range []int{a, b} {
+		if !d.port.Valid(i) {
+			return nil, fmt.Errorf("pcf8575: encoder pin %w (%d)", ErrPinRange, i)
+		}
+	}
+	if a == b {
+		return nil, fmt.Errorf("pcf8575: encoder pin %d used twice", a)
+	}
+	d.mu.Lock()
+	err := d.latchHigh(context.Background(), a)
+	if err == nil {
+		err = d.latchHigh(context.Background(), b)
+	}
+	d.unlock()
+	if err != nil {
+		return nil, err
+	}
+	e := &Encoder{d: d, a: a, b: b, changed: make(chan int, 1), quit: make(chan struct{}), done: make(chan struct{})}
+	v, err := d.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	go e.run(e.state(v))
+	return e, nil
+}
+
+func (e *Encoder) String() string {
+	return fmt.Sprintf("Encoder{%s, %s, %s}", e.d, e.d.pins[e.a], e.d.pins[e.b])
+}
+
+// Halt implements devices.Device by stopping reading the encoder and closing
+// the channel returned by Changed.
+//
+// It returns the bus error that stopped reading, if any.
+func (e *Encoder) Halt() error {
+	e.once.Do(func() { close(e.quit) })
+	<-e.done
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.err
+}
+
+// Position returns the current position in quarter steps.
+func (e *Encoder) Position() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.pos
+}
+
+// Changed returns a channel receiving the new position when it changes.
+//
+// The channel is buffered by one position and intermediate positions are
+// dropped if the receiver is too slow; Position is always accurate. The
+// channel is closed by Halt or when a bus error stops reading.
+func (e *Encoder) Changed() <-chan int {
+	return e.changed
+}
+
+//
+
+func (e *Encoder) run(s int) {
+	defer close(e.done)
+	defer close(e.changed)
+	t := time.NewTicker(e.d.pollInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-e.quit:
+			return
+		default:
+		}
+		if e.d.intPin != nil {
+			if !e.d.intPin.WaitForEdge(e.d.pollInterval) {
+				continue
+			}
+		} else {
+			select {
+			case <-e.quit:
+				return
+			case <-t.C:
+			}
+		}
+		v, err := e.d.ReadAll()
+		if err != nil {
+			e.mu.Lock()
+			e.err = err
+			e.mu.Unlock()
+			return
+		}
+		n := e.state(v)
+		step := encoderSteps[s<<2|n]
+		s = n
+		if step == 0 {
+			continue
+		}
+		e.mu.Lock()
+		e.pos += step
+		p := e.pos
+		e.mu.Unlock()
+		// Replace the unread position, if any.
+		select {
+		case <-e.changed:
+		default:
+		}
+		e.changed <- p
+	}
+}
+
+func (e *Encoder) state(v uint16) int {
+	return int(v>>uint(e.a)&1 | (v>>uint(e.b)&1)<<1)
+}
+
+var _ devices.Device = &Encoder{}
@@ -0,0 +1,52 @@
+// Copyright 2017 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package pcf8575
+
+import (
+	"context"
+	"time"
+)
+
+// Ping reads the port to check that the device is still on the bus and
+// acknowledges its address. The outputs are left unchanged.
+func (d *Dev) Ping() error {
+	d.mu.Lock()
+	defer d.unlock()
+	_, err := d.readState(context.Background())
+	return err
+}
+
+// startHealthCheck starts the goroutine set with WithHealthCheck.
+func (d *Dev) startHealthCheck() {
+	d.healthStop = make(chan struct{})
+	d.healthDone = make(chan struct{})
+	go func() {
+		defer close(d.healthDone)
+		t := time.NewTicker(d.healthInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-d.healthStop:
+				return
+			case <-t.C:
+				err := d.Ping()
+				if err != nil {
+					d.logf("pcf8575 0x%02x: health check: %v", d.addr, err)
+				}
+				d.healthFn(err)
+			}
+		}
+	}()
+}
+
+// stopHealthCheck stops the goroutine started by startHealthCheck, if any,
+// and waits for it to exit.
+func (d *Dev) stopHealthCheck() {
+	if d.healthStop == nil {
+		return
+	}
+	d.healthOnce.Do(func() { close(d.healthStop) })
+	<-d.healthDone
+}
@@ -0,0 +1,61 @@
+// Copyright 2017 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package pcf8575
+
+import "time"
+
+// OutputChange is a change of the output of a pin, as recorded with
+// WithHistory.
+type OutputChange struct {
+	Time  time.Time // When the write was done
+	Index int       // Pin index
+	Old   bool      // Level before the write, like ReadOutput
+	New   bool      // Level after the write, like ReadOutput
+}
+
+// History returns the output changes recorded with WithHistory, oldest first.
+//
+// It returns nil if WithHistory wasn't used. It doesn't do any I/O.
+func (d *Dev) History() []OutputChange {
+	d.mu.Lock()
+	defer d.unlock()
+	if d.history == nil {
+		return nil
+	}
+	out := make([]OutputChange, 0, d.historyLen)
+	start := d.historyNext - d.historyLen
+	if start < 0 {
+		start += len(d.history)
+	}
+	for i := 0; i < d.historyLen; i++ {
+		out = append(out, d.history[(start+i)%len(d.history)])
+	}
+	return out
+}
+
+//
+
+// record appends the changes of the outputs from old to d.port to the
+// history, overwriting the oldest ones once it is full.
+func (d *Dev) record(now time.Time, old uint16) {
+	changed := d.port.Word() ^ old
+	for i := 0; i < PinCount && changed != 0; i++ {
+		m := uint16(1) << uint(i)
+		if changed&m == 0 {
+			continue
+		}
+		changed &^= m
+		d.history[d.historyNext] = OutputChange{
+			Time:  now,
+			Index: i,
+			Old:   (old^d.inverted)&m != 0,
+			New:   (d.port.Word()^d.inverted)&m != 0,
+		}
+		d.historyNext = (d.historyNext + 1) % len(d.history)
+		if d.historyLen < len(d.history) {
+			d.historyLen++
+		}
+	}
+}
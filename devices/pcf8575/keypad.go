@@ -0,0 +1,129 @@
+// Copyright 2017 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package pcf8575
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"periph.io/x/periph/devices"
+)
+
+// Keypad scans a matrix keypad, e.g. a 4x4 keypad using all 16 pins of a
+// PCF8575.
+//
+// The rows are driven low one at a time and the columns are read, a key
+// pressed pulling its column low through the row. No diodes are needed since
+// the pins are quasi-bidirectional: the rows not being scanned are latched
+// high and only weakly pulled up.
+type Keypad struct {
+	p        Expander
+	rows     []int
+	cols     []int
+	keys     [][]rune
+	mask     uint16 // All the pins used by the keypad
+	colMask  uint16
+	debounce time.Duration
+}
+
+// NewKeypad returns a Keypad connected to p.
+//
+// rows and cols are the pin indexes of the rows and columns, keys[r][c] is
+// the key at row r and column c. It doesn't do any I/O.
+func NewKeypad(p Expander, rows, cols []int, keys [][]rune) (*Keypad, error) {
+	if len(rows) == 0 || len(cols) == 0 {
+		return nil, errors.New("pcf8575: keypad needs at least one row and one column")
+	}
+	if len(keys) != len(rows) {
+		return nil, errors.New("pcf8575: keypad layout doesn't match the rows")
+	}
+	for _, k := range keys {
+		if len(k) != len(cols) {
+			return nil, errors.New("pcf8575: keypad layout doesn't match the columns")
+		}
+	}
+	k := &Keypad{p: p, rows: rows, cols: cols, keys: keys, debounce: 10 * time.Millisecond}
+	for j, pins := range [][]int{rows, cols} {
+		for _, i := range pins {
+			if i < 0 || i >= PinCount {
+				return nil, fmt.Errorf("pcf8575: keypad pin %w (%d)", ErrPinRange, i)
+			}
+			if k.mask&(1<<uint(i)) != 0 {
+				return nil, fmt.Errorf("pcf8575: keypad pin %d used twice", i)
+			}
+			k.mask |= 1 << uint(i)
+			if j == 1 {
+				k.colMask |= 1 << uint(i)
+			}
+		}
+	}
+	return k, nil
+}
+
+func (k *Keypad) String() string {
+	return fmt.Sprintf("Keypad{%s}", k.p)
+}
+
+// Halt implements devices.Device.
+func (k *Keypad) Halt() error {
+	return nil
+}
+
+// SetDebounce sets the delay between the two scans that must agree for Scan
+// to report a key. The default is 10ms.
+func (k *Keypad) SetDebounce(d time.Duration) {
+	k.debounce = d
+}
+
+// Scan returns the key currently pressed.
+//
+// It returns false when no key is pressed, or when more than one key is
+// pressed since the matrix can't tell them apart from ghost keys. The matrix
+// is scanned twice, separated by the debounce delay, and the two scans must
+// agree. Each scan costs two I²C transactions per row plus one.
+func (k *Keypad) Scan() (rune, bool, error) {
+	r, c, err := k.scan()
+	if err != nil || r == -1 {
+		return 0, false, err
+	}
+	time.Sleep(k.debounce)
+	r2, c2, err := k.scan()
+	if err != nil || r2 != r || c2 != c {
+		return 0, false, err
+	}
+	return k.keys[r][c], true, nil
+}
+
+// scan scans the matrix once and returns the row and column of the single key
+// pressed, or -1, -1.
+func (k *Keypad) scan() (int, int, error) {
+	row, col := -1, -1
+	n := 0
+	for r, rp := range k.rows {
+		if err := k.p.WriteMask(k.mask, k.mask&^(1<<uint(rp))); err != nil {
+			return -1, -1, err
+		}
+		v, err := k.p.ReadAll()
+		if err != nil {
+			return -1, -1, err
+		}
+		for c, cp := range k.cols {
+			if v&(1<<uint(cp)) == 0 {
+				row, col = r, c
+				n++
+			}
+		}
+	}
+	if err := k.p.WriteMask(k.mask, k.mask); err != nil {
+		return -1, -1, err
+	}
+	if n != 1 {
+		return -1, -1, nil
+	}
+	return row, col, nil
+}
+
+var _ devices.Device = &Keypad{}
@@ -0,0 +1,194 @@
+// Copyright 2017 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package pcf8575
+
+import (
+	"fmt"
+	"time"
+
+	"periph.io/x/periph/devices"
+)
+
+// LCDPins is the mapping between the signals of an HD44780 character LCD and
+// the pins of the expander.
+//
+// Use -1 for Backlight if there is no backlight control. RW is always driven
+// low, the LCD is never read.
+type LCDPins struct {
+	RS, RW, EN     int
+	D4, D5, D6, D7 int
+	Backlight      int
+}
+
+// Backpack is the wiring of the common PCF8574 I²C LCD backpacks.
+var Backpack = LCDPins{RS: 0, RW: 1, EN: 2, Backlight: 3, D4: 4, D5: 5, D6: 6, D7: 7}
+
+// LCD drives an HD44780 compatible character LCD in 4 bits mode.
+type LCD struct {
+	p     Expander
+	pins  LCDPins
+	rows  int
+	mask  uint16 // All the pins used by the LCD
+	clock Clock
+}
+
+// NewLCD returns an LCD of rows lines connected to p.
+//
+// It doesn't do any I/O, call Init first.
+func NewLCD(p Expander, pins LCDPins, rows int) (*LCD, error) {
+	if rows < 1 || rows > 4 {
+		return nil, fmt.Errorf("pcf8575: invalid LCD rows %d", rows)
+	}
+	l := &LCD{p: p, pins: pins, rows: rows, clock: wallClock{}}
+	all := []int{pins.RS, pins.RW, pins.EN, pins.D4, pins.D5, pins.D6, pins.D7}
+	if pins.Backlight != -1 {
+		all = append(all, pins.Backlight)
+	}
+	for _, i := range all {
+		if i < 0 || i >= PinCount {
+			return nil, fmt.Errorf("pcf8575: LCD pin %w (%d)", ErrPinRange, i)
+		}
+		if l.mask&(1<<uint(i)) != 0 {
+			return nil, fmt.Errorf("pcf8575: LCD pin %d used twice", i)
+		}
+		l.mask |= 1 << uint(i)
+	}
+	return l, nil
+}
+
+// Init initializes the LCD in 4 bits mode, turns the display on, clears it
+// and turns the backlight on.
+//
+// The LCD needs 40ms after power up before Init can be called.
+func (l *LCD) Init() error {
+	// Datasheet figure 24: initializing by instruction, the LCD may be in 8
+	// bits mode or halfway through a 4 bits transfer.
+	for _, w := range []time.Duration{4100 * time.Microsecond, 100 * time.Microsecond, 100 * time.Microsecond} {
+		if err := l.nibble(0x3, false); err != nil {
+			return err
+		}
+		l.clock.Sleep(w)
+	}
+	if err := l.nibble(0x2, false); err != nil {
+		return err
+	}
+	// Function set: 4 bits, 2 lines if rows > 1, 5x8 dots.
+	f := byte(0x20)
+	if l.rows > 1 {
+		f |= 0x08
+	}
+	// Display on, cursor off; entry mode increment.
+	for _, c := range []byte{f, 0x0c, 0x06} {
+		if err := l.command(c); err != nil {
+			return err
+		}
+	}
+	return l.Clear()
+}
+
+// Clear clears the display and moves the cursor to the top left.
+func (l *LCD) Clear() error {
+	if err := l.command(0x01); err != nil {
+		return err
+	}
+	// Clear display takes 1.52ms.
+	l.clock.Sleep(2 * time.Millisecond)
+	return nil
+}
+
+// SetCursor moves the cursor to column col of row row, both starting at 0.
+func (l *LCD) SetCursor(col, row int) error {
+	if row < 0 || row >= l.rows || col < 0 || col >= 40 {
+		return fmt.Errorf("pcf8575: invalid LCD position %d,%d", col, row)
+	}
+	offsets := [...]int{0x00, 0x40, 0x14, 0x54}
+	return l.command(0x80 | byte(offsets[row]+col))
+}
+
+// Print writes the bytes of s at the cursor position.
+//
+// The characters are sent as is, only ASCII characters are portable across
+// LCD character ROMs.
+func (l *LCD) Print(s string) error {
+	for i := 0; i < len(s); i++ {
+		if err := l.write(s[i], true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetClock sets the Clock used to wait for the LCD, the wall clock by default,
+// e.g. a fake clock in tests.
+func (l *LCD) SetClock(c Clock) {
+	l.clock = c
+}
+
+func (l *LCD) String() string {
+	return fmt.Sprintf("LCD{%s}", l.p)
+}
+
+// Halt implements devices.Device.
+func (l *LCD) Halt() error {
+	return nil
+}
+
+func (l *LCD) command(c byte) error {
+	return l.write(c, false)
+}
+
+// write sends a byte as two nibbles in a single I²C transaction.
+func (l *LCD) write(b byte, rs bool) error {
+	return l.send(append(l.pulse(b>>4, rs), l.pulse(b&0x0f, rs)...))
+}
+
+// nibble sends 4 bits in a single I²C transaction.
+func (l *LCD) nibble(n byte, rs bool) error {
+	return l.send(l.pulse(n, rs))
+}
+
+// send writes the states in a single I²C transaction if the Expander supports
+// it, e.g. Dev, or one transaction per state otherwise.
+//
+// Each state lasts at least the time to send it on the bus, enough to satisfy
+// the setup, hold and pulse width timings. The I²C transactions are slow
+// enough for the 37µs execution time of most instructions.
+func (l *LCD) send(states []uint16) error {
+	if s, ok := l.p.(sequenceWriter); ok {
+		return s.WriteMaskSequence(l.mask, states)
+	}
+	for _, v := range states {
+		if err := l.p.WriteMask(l.mask, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pulse returns the states sending 4 bits with a pulse on EN: RS and the data
+// are set up with EN low, then EN is raised and lowered while they're held.
+func (l *LCD) pulse(n byte, rs bool) []uint16 {
+	var v uint16
+	for i, p := range [...]int{l.pins.D4, l.pins.D5, l.pins.D6, l.pins.D7} {
+		if n&(1<<uint(i)) != 0 {
+			v |= 1 << uint(p)
+		}
+	}
+	if rs {
+		v |= 1 << uint(l.pins.RS)
+	}
+	if l.pins.Backlight != -1 {
+		v |= 1 << uint(l.pins.Backlight)
+	}
+	return []uint16{v, v | 1<<uint(l.pins.EN), v}
+}
+
+// sequenceWriter is implemented by the Expanders able to write several states
+// in a single I²C transaction.
+type sequenceWriter interface {
+	WriteMaskSequence(mask uint16, values []uint16) error
+}
+
+var _ devices.Device = &LCD{}
@@ -0,0 +1,50 @@
+// Copyright 2017 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package pcf8575
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Nibble is a 4 bits parallel port over four pins of a PCF8575, e.g. the data
+// lines of a device with a 4 bits bus.
+type Nibble struct {
+	d    *Dev
+	pins [4]int
+	mask uint16
+}
+
+// Nibble returns a 4 bits port over the pins, bit 0 of the values being
+// mapped to pins[0]. It doesn't do any I/O.
+func (d *Dev) Nibble(pins [4]int) (*Nibble, error) {
+	n := &Nibble{d: d, pins: pins}
+	for _, i := range pins {
+		if !d.port.Valid(i) {
+			return nil, fmt.Errorf("PCF8575.Nibble: %w (%d)", ErrPinRange, i)
+		}
+		if n.mask&(1<<uint(i)) != 0 {
+			return nil, errors.New("PCF8575.Nibble: the pins must be different")
+		}
+		n.mask |= 1 << uint(i)
+	}
+	return n, nil
+}
+
+func (n *Nibble) String() string {
+	return fmt.Sprintf("Nibble{%s, %v}", n.d, n.pins)
+}
+
+// Write sets the four pins to the low nibble of value in a single I²C
+// transaction, leaving the other pins unchanged. The high nibble is ignored.
+func (n *Nibble) Write(value byte) error {
+	var v uint16
+	for b, i := range n.pins {
+		if value&(1<<uint(b)) != 0 {
+			v |= 1 << uint(i)
+		}
+	}
+	return n.d.WriteMask(n.mask, v)
+}
@@ -0,0 +1,330 @@
+// Copyright 2017 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package pcf8575
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"periph.io/x/periph/conn/gpio"
+)
+
+// Opt is an option to pass to New.
+type Opt func(d *Dev) error
+
+// WithInitialState sets the state written to the outputs by New, with the
+// same bit ordering as WriteAll.
+//
+// The default is the device's power-on state, 0xFFFF, or 0 with
+// WithPortInverted. Pins are quasi-bidirectional, only the pins left high on
+// the bus can be used as inputs.
+func WithInitialState(state uint16) Opt {
+	return func(d *Dev) error {
+		d.port.SetWord(state)
+		d.initialSet = true
+		return nil
+	}
+}
+
+// WithAnyAddress makes New accept any 7 bits I²C address instead of only 0x20
+// to 0x27, e.g. for a compatible device or behind an address translator.
+func WithAnyAddress() Opt {
+	return func(d *Dev) error {
+		d.anyAddr = true
+		return nil
+	}
+}
+
+// WithNoInitialWrite skips the write done by New.
+//
+// The cached output state is still initialized to the initial state, which
+// should match the actual state of the device, e.g. the power-on state.
+func WithNoInitialWrite() Opt {
+	return func(d *Dev) error {
+		d.noInitialWrite = true
+		return nil
+	}
+}
+
+// WithInterruptPin uses p, connected to the device's INT output, to detect
+// input changes instead of polling the bus.
+//
+// INT is an open drain output that goes low when any input changes and is
+// released when the port is read. New sets p as input with a pull-up and
+// falling edge detection. This enables edge detection on the pins returned by
+// Pin and Pins.
+func WithInterruptPin(p gpio.PinIn) Opt {
+	return func(d *Dev) error {
+		d.intPin = p
+		return nil
+	}
+}
+
+// WithSafeState sets the state written to the outputs by Halt, with the same
+// bit ordering as WriteAll.
+//
+// The default is the device's power-on state, 0xFFFF, or 0 with
+// WithPortInverted. Use 0 when driving active high loads, e.g. a relay board
+// driven through transistors.
+func WithSafeState(state uint16) Opt {
+	return func(d *Dev) error {
+		d.safe = state
+		d.safeSet = true
+		return nil
+	}
+}
+
+// WithDebounceSampling sets how ReadInputDebounced samples the pin: every
+// interval, for at most timeout.
+//
+// The defaults are 1ms and 1s. A shorter interval is more responsive but
+// causes more bus traffic.
+func WithDebounceSampling(interval, timeout time.Duration) Opt {
+	return func(d *Dev) error {
+		if interval <= 0 || timeout <= 0 {
+			return errors.New("pcf8575: invalid debounce sampling")
+		}
+		d.debounceInterval = interval
+		d.debounceTimeout = timeout
+		return nil
+	}
+}
+
+// WithPollInterval sets the interval at which Watch and WaitForPinEdge read
+// the pins when the INT pin is not used. With the INT pin, the pins are only
+// read when INT signals a change and it is the interval at which Watch checks
+// for cancellation.
+//
+// Polling trades bus traffic for latency: each poll is a 3 bytes transaction,
+// about 0.3ms at 100kHz, so the default of 10ms keeps about 3% of the bus busy
+// and misses pulses shorter than the interval. Use the INT pin to get both a
+// low latency and no traffic while the inputs are idle.
+func WithPollInterval(interval time.Duration) Opt {
+	return func(d *Dev) error {
+		if interval <= 0 {
+			return errors.New("pcf8575: invalid poll interval")
+		}
+		d.pollInterval = interval
+		return nil
+	}
+}
+
+// WithVerifyWrites reads the port back after each write and fails with
+// ErrVerify if a pin latched low doesn't read low, e.g. because of a short
+// to the supply or a reset of the device.
+//
+// Only the pins latched low can be verified: the pins latched high are inputs
+// and read the external level. This doubles the bus traffic of the writes.
+func WithVerifyWrites() Opt {
+	return func(d *Dev) error {
+		d.verify = true
+		return nil
+	}
+}
+
+// WithRetry retries the failed I²C transactions, e.g. because of a NACK on a
+// noisy bus, up to a total of attempts, waiting backoff before the first retry
+// and doubling the delay for each following retry. Use WithBackoff for other
+// delays.
+//
+// The default is a single attempt. Retrying is safe since each write sends the
+// whole cached output state. The last error is returned if all the attempts
+// fail.
+func WithRetry(attempts int, backoff time.Duration) Opt {
+	return func(d *Dev) error {
+		if attempts < 1 || backoff < 0 {
+			return errors.New("pcf8575: invalid retry")
+		}
+		d.attempts = attempts
+		d.backoff = backoff
+		return nil
+	}
+}
+
+// WithBackoff sets the delays between the attempts set with WithRetry,
+// e.g. a LinearBackoff on a bus shared with chatty devices, where retrying
+// quickly just collides again. It takes precedence over the backoff passed to
+// WithRetry, whatever the order of the options.
+//
+// The wait is interrupted when the context passed to the *Context methods is
+// done.
+func WithBackoff(b Backoff) Opt {
+	return func(d *Dev) error {
+		if b == nil {
+			return errors.New("pcf8575: invalid backoff")
+		}
+		d.backoffFn = b
+		return nil
+	}
+}
+
+// WithAutoReinit writes the cached output state again once the device answers
+// after failures consecutive failed I²C transactions, e.g. when the device
+// drops off the bus because of loose wiring or a power glitch and comes back
+// in its power-on state.
+//
+// Only reads need it, any write already sends the whole cached output state.
+func WithAutoReinit(failures int) Opt {
+	return func(d *Dev) error {
+		if failures < 1 {
+			return errors.New("pcf8575: invalid auto reinit failures")
+		}
+		d.reinitAfter = failures
+		return nil
+	}
+}
+
+// WithPortInverted inverts all the bits written to and read from the bus, for
+// boards inverting the 16 lines with external logic, so the API still uses the
+// levels of the board's lines.
+//
+// The cached output state, DumpState, Status and MarshalBinary use the levels
+// of the board's lines, ReadRaw and the tracer set with WithTracer the bytes
+// on the bus. It composes with SetInverted which is applied on top of it: a
+// pin set as inverted with SetInverted uses the levels on the bus.
+//
+// The quasi-bidirectional semantics apply on the bus: a pin can only be read
+// when latched high on the bus, i.e. low in the cache, and In latches it so.
+// The pins set as input with SetDirection are still latched high on the bus.
+// The default initial and safe states are all the pins high on the bus, see
+// WithInitialState and WithSafeState.
+func WithPortInverted() Opt {
+	return func(d *Dev) error {
+		d.portInverted = true
+		return nil
+	}
+}
+
+// OutOfRangePolicy is how WriteOutput, ReadOutput, ReadOutputLatch and
+// ReadInput handle a pin index out of range, see WithOutOfRangePolicy.
+type OutOfRangePolicy int
+
+// Valid OutOfRangePolicy.
+const (
+	// OutOfRangeError returns ErrPinRange, the default.
+	OutOfRangeError OutOfRangePolicy = iota
+	// OutOfRangeIgnore does nothing: writes are dropped and reads return false.
+	OutOfRangeIgnore
+	// OutOfRangePanic panics, e.g. to fail fast in tests.
+	OutOfRangePanic
+)
+
+// WithOutOfRangePolicy sets how WriteOutput, ReadOutput, ReadOutputLatch and
+// ReadInput, and their Context variants, handle a pin index out of range. The
+// other methods always return ErrPinRange.
+func WithOutOfRangePolicy(policy OutOfRangePolicy) Opt {
+	return func(d *Dev) error {
+		if policy < OutOfRangeError || policy > OutOfRangePanic {
+			return fmt.Errorf("pcf8575: invalid out of range policy %d", policy)
+		}
+		d.rangePolicy = policy
+		return nil
+	}
+}
+
+// WithPinRateLimit limits the changes of the output of the pin at index to one
+// every minInterval, e.g. to protect a relay from a control loop oscillating.
+//
+// A write changing the pin sooner waits until minInterval elapsed since the
+// last change, with the Dev locked, unless WithRateLimitError is used. It
+// applies to all the writes except Halt, which always writes the safe state.
+// The other pins are not affected. The time is taken from the Clock set with
+// WithClock.
+func WithPinRateLimit(index int, minInterval time.Duration) Opt {
+	return func(d *Dev) error {
+		if index < 0 || index >= PinCount {
+			return fmt.Errorf("pcf8575: rate limit %w (%d)", ErrPinRange, index)
+		}
+		if minInterval <= 0 {
+			return errors.New("pcf8575: invalid rate limit interval")
+		}
+		d.minInterval[index] = minInterval
+		return nil
+	}
+}
+
+// WithRateLimitError makes the writes changing a pin faster than set with
+// WithPinRateLimit fail with ErrRateLimited instead of waiting.
+//
+// Nothing is written and the rate limited pins keep their previous level in
+// the cache.
+func WithRateLimitError() Opt {
+	return func(d *Dev) error {
+		d.rateLimitErr = true
+		return nil
+	}
+}
+
+// WithLogger calls fn to log the notable events: the retries set with
+// WithRetry, the restorations of the outputs set with WithAutoReinit and the
+// failures of the health check set with WithHealthCheck, e.g. log.Printf.
+//
+// Unlike WithTracer, nothing is logged while the bus works. fn may be called
+// with the Dev locked and must not call back into it.
+func WithLogger(fn func(format string, args ...interface{})) Opt {
+	return func(d *Dev) error {
+		d.logger = fn
+		return nil
+	}
+}
+
+// WithClock sets the Clock used for the timing of PWM and WithPinRateLimit and
+// for the time of the History entries, e.g. a fake clock in tests. The default
+// is the wall clock.
+func WithClock(c Clock) Opt {
+	return func(d *Dev) error {
+		if c == nil {
+			return errors.New("pcf8575: invalid clock")
+		}
+		d.clock = c
+		return nil
+	}
+}
+
+// WithHistory records the last size changes of the outputs, see Dev.History,
+// e.g. to find out what turned a relay off and when.
+//
+// Each pin whose level changed in a successful write is recorded. Nothing is
+// recorded by default.
+func WithHistory(size int) Opt {
+	return func(d *Dev) error {
+		if size < 1 {
+			return errors.New("pcf8575: invalid history size")
+		}
+		d.history = make([]OutputChange, size)
+		return nil
+	}
+}
+
+// WithHealthCheck calls Ping every interval from a goroutine and passes the
+// result to fn, e.g. to raise an alert when the device is disconnected.
+//
+// The goroutine is stopped by Halt, which waits for fn to return.
+func WithHealthCheck(interval time.Duration, fn func(error)) Opt {
+	return func(d *Dev) error {
+		if interval <= 0 || fn == nil {
+			return errors.New("pcf8575: invalid health check")
+		}
+		d.healthInterval = interval
+		d.healthFn = fn
+		return nil
+	}
+}
+
+// WithTracer calls fn after each I²C transaction with the operation, "read",
+// "write" or "writeread" for WriteReadAll, the bytes written and read and the
+// error if the transaction failed, e.g. to log the traffic while debugging a
+// misbehaving bus.
+//
+// fn is called after the Dev lock is released, in the goroutine that did the
+// transaction, so it may call back into the Dev. The slices are copies that fn
+// can keep.
+func WithTracer(fn func(op string, write, read []byte, err error)) Opt {
+	return func(d *Dev) error {
+		d.tracer = fn
+		return nil
+	}
+}
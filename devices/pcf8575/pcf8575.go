@@ -4,110 +4,2027 @@
 
 // Package pcf8575 controls a Texas Instruments PCF8575 device over I²C.
 //
-// Interrupt pin on device is not supported.
+// The interrupt pin (INT) is supported via WithInterruptPin.
+//
+// The outputs are quasi-bidirectional: a pin latched low sinks up to 25mA but
+// a pin latched high only sources about 100µA through its weak pull-up. Loads
+// like LEDs must be connected between VDD and the pin, i.e. be active low, or
+// be driven through a transistor. See Dev.SetInverted to keep the code active
+// high.
 //
 // Datasheet
 //
 // http://www.ti.com/lit/ds/symlink/pcf8575.pdf
-
 package pcf8575
 
 import (
-    "errors"
-    "fmt"
+	"context"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"periph.io/x/periph/conn"
+	"periph.io/x/periph/conn/gpio"
+	"periph.io/x/periph/conn/gpio/gpioreg"
+	"periph.io/x/periph/conn/i2c"
+	"periph.io/x/periph/conn/i2c/i2creg"
+	"periph.io/x/periph/devices"
+	"periph.io/x/periph/devices/internal/pcf857x"
+)
+
+// PinCount is the number of pins of a PCF8575.
+const PinCount = 16
 
-    "periph.io/x/periph/conn"
-    "periph.io/x/periph/conn/i2c"
-    "periph.io/x/periph/devices"
+// Indexes of the pins, as named in the datasheet. P00 to P07 are the first
+// port, P10 to P17 the second one.
+const (
+	P00 = iota
+	P01
+	P02
+	P03
+	P04
+	P05
+	P06
+	P07
+	P10
+	P11
+	P12
+	P13
+	P14
+	P15
+	P16
+	P17
 )
 
+// Drive capability of a pin, in µA, as returned by Pin.Drive.
+const (
+	// SinkCurrent is the maximum current sunk by a pin latched low.
+	SinkCurrent = 25000
+	// SourceCurrent is the typical current sourced by the weak pull-up of a
+	// pin latched high.
+	SourceCurrent = 100
+)
+
+// ErrPinRange is returned when a pin index is not between 0 and 15.
+//
+// It is the same error as pcf8574.ErrPinRange.
+//
+// It is wrapped with the name of the method and the offending index, use
+// errors.Is to test for it.
+var ErrPinRange = pcf857x.ErrPinRange
+
+// ErrLatchedLow is returned when reading the input of a pin whose output is
+// latched low, which always reads low.
+var ErrLatchedLow = errors.New("pin is latched low and can't be read as an input")
+
+// ErrDirection is returned when writing to a pin set as input with
+// SetDirection.
+var ErrDirection = errors.New("pin is set as an input")
+
+// ErrReserved is returned by Reserve and Release when the pin is reserved by
+// another owner.
+var ErrReserved = errors.New("pin is reserved")
+
+// ErrValueOverflow is returned by WriteField when the value doesn't fit in
+// the field.
+var ErrValueOverflow = errors.New("value doesn't fit in the field")
+
+// ErrRateLimited is returned when WithRateLimitError is used and a write
+// changes a pin faster than set with WithPinRateLimit.
+var ErrRateLimited = errors.New("pin changed faster than its rate limit")
+
+// ErrVerify is returned when WithVerifyWrites is used and a pin latched low
+// doesn't read back low.
+var ErrVerify = errors.New("output readback mismatch")
+
 // New returns an object that communicates over I²C to a PCF8575 I/O expander.
 //
-// All outputs are initialized as high (the device's default power-on state).
-func New(i i2c.Bus, addr uint16) (*Dev, error) {
-    d := &Dev{c: &i2c.Dev{Bus: i, Addr: addr}, lowPins: 0xff, highPins: 0xff}
-    err := d.updateState()
-    if err != nil {
-        return nil, err
-    }
-    
-    return d, nil
+// All outputs are initialized as high (the device's default power-on state)
+// unless WithInitialState or WithNoInitialWrite is used.
+//
+// The address must be between 0x20 and 0x27, as set by the A0 to A2 pins,
+// unless WithAnyAddress is used.
+//
+// The 16 pins are registered in gpioreg with names like PCF8575_0x20_P00, and
+// the Dev itself as a gpio.Group named like PCF8575_0x20. Registration fails
+// if another device already registered the same names, for example a PCF8575
+// at the same address on another bus.
+func New(i i2c.Bus, addr uint16, opts ...Opt) (*Dev, error) {
+	return NewWithContext(context.Background(), i, addr, opts...)
+}
+
+// NewWithContext is the same as New but gives up the initial write when ctx
+// is canceled, e.g. to bound the startup time when the bus may hang.
+//
+// See WriteOutputContext for when ctx is checked.
+func NewWithContext(ctx context.Context, i i2c.Bus, addr uint16, opts ...Opt) (*Dev, error) {
+	d := &Dev{c: &i2c.Dev{Bus: i, Addr: addr}, addr: addr, port: pcf857x.NewPort(PinCount), safe: 0xffff, written: 0xffff, clock: wallClock{}, attempts: 1, watchRising: 0xffff, watchFalling: 0xffff, debounceInterval: time.Millisecond, debounceTimeout: time.Second, pollInterval: 10 * time.Millisecond}
+	for i := range d.pins {
+		d.pins[i] = &Pin{d: d, index: i}
+	}
+	for _, opt := range opts {
+		if err := opt(d); err != nil {
+			return nil, err
+		}
+	}
+	// The device powers on with all its pins high on the bus.
+	d.written = d.powerOn()
+	if !d.initialSet {
+		d.port.SetWord(d.written)
+	}
+	if !d.safeSet {
+		d.safe = d.written
+	}
+	if d.anyAddr {
+		if addr > 0x7f {
+			return nil, fmt.Errorf("pcf8575: invalid I²C address 0x%x", addr)
+		}
+	} else if addr < 0x20 || addr > 0x27 {
+		return nil, fmt.Errorf("pcf8575: invalid address 0x%x; must be between 0x20 and 0x27, see WithAnyAddress", addr)
+	}
+	if d.intPin != nil {
+		if err := d.intPin.In(gpio.PullUp, gpio.FallingEdge); err != nil {
+			return nil, fmt.Errorf("pcf8575: INT pin: %w", err)
+		}
+	}
+	if !d.noInitialWrite {
+		d.mu.Lock()
+		err := d.updateState(ctx)
+		d.unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := d.register(); err != nil {
+		return nil, err
+	}
+	if d.healthFn != nil {
+		d.startHealthCheck()
+	}
+	return d, nil
+}
+
+// Open opens the I²C bus and returns the PCF8575 at the address given, in the
+// form "bus:address", e.g. "1:0x20". The bus is anything accepted by
+// i2creg.Open; the default bus is used if only the address is given, e.g.
+// "0x20".
+//
+// The bus is closed by Halt. If the bus can't be opened, the error starts with
+// "pcf8575: open bus"; if the device doesn't acknowledge the initial write, it
+// starts with "pcf8575: write output" like with New.
+func Open(name string, opts ...Opt) (*Dev, error) {
+	bus, a := "", name
+	if i := strings.LastIndexByte(name, ':'); i != -1 {
+		bus, a = name[:i], name[i+1:]
+	}
+	addr, err := strconv.ParseUint(a, 0, 16)
+	if err != nil {
+		return nil, fmt.Errorf("pcf8575: invalid address in %q", name)
+	}
+	b, err := i2creg.Open(bus)
+	if err != nil {
+		return nil, fmt.Errorf("pcf8575: open bus %q: %w", bus, err)
+	}
+	d, err := New(b, uint16(addr), opts...)
+	if err != nil {
+		b.Close()
+		return nil, err
+	}
+	d.bus = b
+	return d, nil
+}
+
+// Expander is the part of Dev used by code driving the pins, e.g. NewLCD, so
+// it can be tested without a device with pcf8575test.Fake.
+//
+// It is implemented by Dev and pcf8574.Dev, the bit ordering is the same as
+// Dev.WriteAll.
+type Expander interface {
+	conn.Resource
+	WriteOutput(index int, state bool) error
+	ReadOutput(index int) (bool, error)
+	ReadInput(index int) (bool, error)
+	WriteAll(state uint16) error
+	WriteMask(mask, values uint16) error
+	ReadAll() (uint16, error)
 }
 
 // Dev is a handle to a pcf8575.
 type Dev struct {
-    c        conn.Conn // Connection
-    lowPins  byte       // State of pins P00-P07
-    highPins byte       // State of pins P10-P17
+	// Updated atomically, first in the struct for 64 bits alignment.
+	stats Stats
+
+	c    conn.Conn      // Connection
+	addr uint16         // I²C address
+	pins [PinCount]*Pin // gpio.PinIO wrappers, one per pin
+
+	noInitialWrite bool          // Skip the initial write in New
+	anyAddr        bool          // Accept any 7 bits address
+	intPin         gpio.PinIn    // INT pin; optional
+	safe           uint16        // State written on Halt
+	verify         bool          // Read back the outputs after each write
+	attempts       int           // Number of attempts of each I²C transaction
+	backoff        time.Duration // Delay before the first retry
+	backoffFn      Backoff       // Set by WithBackoff; overrides backoff
+	reinitAfter    int           // Failures before restoring the outputs; 0 to disable
+	rateLimitErr   bool          // Fail instead of waiting on rate limited pins
+	portInverted   bool          // All the bits are inverted on the bus
+	initialSet     bool          // Set by WithInitialState
+	safeSet        bool          // Set by WithSafeState
+
+	minInterval [PinCount]time.Duration // Set by WithPinRateLimit; 0 if not limited
+	rangePolicy OutOfRangePolicy        // Set by WithOutOfRangePolicy
+
+	debounceInterval time.Duration // Sampling interval of ReadInputDebounced
+	debounceTimeout  time.Duration // Timeout of ReadInputDebounced
+	pollInterval     time.Duration // Polling interval of Watch
+
+	healthInterval time.Duration // Set by WithHealthCheck
+	healthFn       func(error)   // Set by WithHealthCheck
+	healthStop     chan struct{} // Closed to stop the health check goroutine
+	healthDone     chan struct{} // Closed when the health check goroutine exits
+	healthOnce     sync.Once     // Closes healthStop
+
+	tracer func(op string, write, read []byte, err error) // Set by WithTracer
+	logger func(format string, args ...interface{})       // Set by WithLogger
+	clock  Clock                                          // Set by WithClock
+	bus    i2c.BusCloser                                  // Opened by Open, closed by Halt
+
+	nameMu sync.Mutex
+	names  [PinCount]string // Aliases set by SetNames
+
+	cbMu      sync.Mutex
+	callbacks [PinCount][]func(bool) // Callbacks set by OnChange
+	stopWatch func()                 // Stops the OnChange goroutine
+	watchDone chan struct{}          // Closed when the OnChange goroutine exits
+
+	mu           sync.Mutex
+	port         pcf857x.Port        // Cached state of the outputs
+	registered   bool                // Pins are registered in gpioreg
+	halted       bool                // Halt was called successfully
+	batch        bool                // Writes are staged until Flush is called
+	lastRead     uint16              // Input levels as of the last read
+	reported     uint16              // Input levels as reported by WaitForEdge
+	edgeInit     bool                // reported is initialized
+	inverted     uint16              // Pins with inverted polarity
+	dirty        bool                // The last write failed
+	inputs       uint16              // Pins set as input by SetDirection
+	traces       []trace             // Pending calls to tracer
+	failures     int                 // Consecutive failed transactions
+	owners       [PinCount]string    // Set by Reserve
+	watchRising  uint16              // Pins whose rising edges are reported by Watch
+	watchFalling uint16              // Pins whose falling edges are reported by Watch
+	written      uint16              // Output state as last written successfully
+	lastChange   [PinCount]time.Time // Last change of the rate limited pins
+	history      []OutputChange      // Ring buffer set by WithHistory
+	groups       map[string][]int    // Set by DefineGroup
+	historyNext  int                 // Next index to write in history
+	historyLen   int                 // Number of changes in history
 }
 
+// String returns the I²C address and the cached output state, with the same
+// bit ordering as WriteAll, e.g. PCF8575{0x20, out=0xFFFF}.
+//
+// It doesn't do any I/O.
 func (d *Dev) String() string {
-    return fmt.Sprintf("PCF8575{%s}", d.c)
+	d.mu.Lock()
+	defer d.unlock()
+	return fmt.Sprintf("PCF8575{0x%02x, out=0x%04X}", d.addr, d.port.Word())
+}
+
+// Stats are cumulative counters of the I²C transactions done by a Dev.
+type Stats struct {
+	Writes  uint64 // Writes of the outputs, including the failed ones
+	Reads   uint64 // Reads of the inputs, including the failed ones
+	Retries uint64 // Attempts beyond the first one, see WithRetry
+	Errors  uint64 // Transactions that failed after all the attempts
+}
+
+// Stats returns the counters of the I²C transactions done so far, e.g. to
+// monitor the health of the bus.
+//
+// It doesn't lock the Dev.
+func (d *Dev) Stats() Stats {
+	return Stats{
+		Writes:  atomic.LoadUint64(&d.stats.Writes),
+		Reads:   atomic.LoadUint64(&d.stats.Reads),
+		Retries: atomic.LoadUint64(&d.stats.Retries),
+		Errors:  atomic.LoadUint64(&d.stats.Errors),
+	}
+}
+
+// Status is a snapshot of the state of a Dev, as returned by Dev.Status.
+//
+// The words have the same bit ordering as Dev.WriteAll.
+type Status struct {
+	Addr      uint16           // I²C address
+	Output    uint16           // Output latch, like Dev.ReadOutput
+	Input     uint16           // Levels read from the device, like Dev.ReadAll
+	InputPins uint16           // Pins set as input with Dev.SetDirection
+	Inverted  uint16           // Pins set as inverted with Dev.SetInverted
+	Names     [PinCount]string // Names of the pins, as returned by Pin.Name
+}
+
+// Status returns a snapshot of the state of the Dev, e.g. to be serialized by
+// a debug endpoint. See DumpState for a human readable version.
+//
+// It does a single read to get the input levels, everything else comes from
+// the cache.
+func (d *Dev) Status() (Status, error) {
+	d.mu.Lock()
+	defer d.unlock()
+	st := Status{
+		Addr:      d.addr,
+		Output:    d.port.Word() ^ d.inverted,
+		InputPins: d.inputs,
+		Inverted:  d.inverted,
+	}
+	for i, p := range d.pins {
+		st.Names[i] = p.Name()
+	}
+	s, err := d.readState(context.Background())
+	if err != nil {
+		return st, err
+	}
+	st.Input = pcf857x.Word(s) ^ d.inverted
+	return st, nil
+}
+
+// DumpState returns a table of the state of every pin, one per line, for
+// debugging: its name, direction, polarity and output latch and, if live is
+// true, its level read from the device.
+//
+// Only the live read does I/O. The levels take SetInverted into account.
+func (d *Dev) DumpState(live bool) string {
+	d.mu.Lock()
+	defer d.unlock()
+	var in uint16
+	var err error
+	if live {
+		var s []byte
+		if s, err = d.readState(context.Background()); err == nil {
+			in = pcf857x.Word(s) ^ d.inverted
+		}
+	}
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprint(w, "PIN\tNAME\tDIR\tINV\tOUT")
+	if live {
+		fmt.Fprint(w, "\tIN")
+	}
+	fmt.Fprint(w, "\n")
+	for i, p := range d.pins {
+		m := uint16(1) << uint(i)
+		dir, inv := "out", "no"
+		if d.inputs&m != 0 {
+			dir = "in"
+		}
+		if d.inverted&m != 0 {
+			inv = "yes"
+		}
+		fmt.Fprintf(w, "P%d%d\t%s\t%s\t%s\t%s", i/8, i%8, p.Name(), dir, inv, level(d.port.Get(i) != d.isInverted(i)))
+		if live {
+			if err != nil {
+				fmt.Fprint(w, "\t?")
+			} else {
+				fmt.Fprintf(w, "\t%s", level(in&m != 0))
+			}
+		}
+		fmt.Fprint(w, "\n")
+	}
+	w.Flush()
+	if err != nil {
+		fmt.Fprintf(&b, "%v\n", err)
+	}
+	return b.String()
+}
+
+// Conn returns the connection to the device, e.g. to issue raw transactions.
+//
+// Bypassing the Dev to write to the device desynchronizes the cached output
+// state; use Reset or WriteAll afterward.
+func (d *Dev) Conn() conn.Conn {
+	return d.c
 }
 
+// Halt writes the safe state to the outputs and unregisters the pins from
+// gpioreg. It is the release hook of conn.Resource.
+//
+// The safe state defaults to all high, the device's power-on state, and can
+// be changed with WithSafeState. Staged writes are discarded, the callbacks
+// registered with OnChange are removed and the health check set with
+// WithHealthCheck is stopped. If the Dev was created with
+// Open, the bus is closed too.
+//
+// The pins are unregistered even if the write fails, in which case Halt can be
+// retried. The Dev shouldn't be used after Halt. Calling Halt again after a
+// success is a no-op.
 func (d *Dev) Halt() error {
-    return nil
+	d.StopWatching()
+	d.stopHealthCheck()
+	d.mu.Lock()
+	defer d.unlock()
+	if d.halted {
+		return nil
+	}
+	d.batch = false
+	d.port.SetWord(d.safe)
+	// The safe state isn't rate limited.
+	d.lastChange = [PinCount]time.Time{}
+	err := d.updateState(context.Background())
+	if err1 := d.unregister(); err == nil {
+		err = err1
+	}
+	d.halted = err == nil
+	if d.halted && d.bus != nil {
+		err = d.bus.Close()
+	}
+	return err
+}
+
+// Reset sets all the outputs high on the bus, the device's power-on state,
+// i.e. low with WithPortInverted.
+//
+// Unlike Halt, the Dev is still usable afterward. The write is done
+// immediately and stops staging writes. If the write fails, the cached output
+// state is left unchanged.
+func (d *Dev) Reset() error {
+	d.mu.Lock()
+	defer d.unlock()
+	prev := d.port.Word()
+	d.port.SetWord(d.powerOn())
+	if err := d.updateState(context.Background()); err != nil {
+		d.port.SetWord(prev)
+		return err
+	}
+	d.batch = false
+	return nil
+}
+
+// Sync writes the cached output state to the device, then reads back the
+// level of all 16 pins, e.g. to recover after the device was reset by a power
+// glitch.
+//
+// The outputs are authoritative: they are driven from the cache, including
+// writes staged with Begin, while the inputs are refreshed from the device.
+// The returned word is the same as ReadAll.
+func (d *Dev) Sync() (uint16, error) {
+	d.mu.Lock()
+	defer d.unlock()
+	if err := d.updateState(context.Background()); err != nil {
+		return 0, err
+	}
+	s, err := d.readState(context.Background())
+	if err != nil {
+		return 0, err
+	}
+	return pcf857x.Word(s) ^ d.inverted, nil
+}
+
+// SetNames sets aliases for the pins, which are then returned by the Name
+// method of the gpio.PinIO wrappers and used to register them in gpioreg.
+//
+// The keys are the pin indexes. Pins not in names keep their alias if any, an
+// empty string restores the default name, e.g. PCF8575_0x20_P00. If the
+// registration of the new names fails, the previous names are restored.
+func (d *Dev) SetNames(names map[int]string) error {
+	for i := range names {
+		if !d.port.Valid(i) {
+			return fmt.Errorf("PCF8575.SetNames: %w (%d)", ErrPinRange, i)
+		}
+	}
+	d.mu.Lock()
+	defer d.unlock()
+	d.nameMu.Lock()
+	prev := d.names
+	d.nameMu.Unlock()
+	registered := d.registered
+	if err := d.unregister(); err != nil {
+		return err
+	}
+	d.nameMu.Lock()
+	for i, n := range names {
+		d.names[i] = n
+	}
+	d.nameMu.Unlock()
+	if !registered {
+		return nil
+	}
+	if err := d.register(); err != nil {
+		d.nameMu.Lock()
+		d.names = prev
+		d.nameMu.Unlock()
+		if err1 := d.register(); err1 != nil {
+			return err1
+		}
+		return err
+	}
+	return nil
+}
+
+// Pin returns the gpio.PinIO for the pin at index, 0 being P00 and 15 being
+// P17.
+//
+// Returns gpio.INVALID if index is out of range.
+func (d *Dev) Pin(index int) gpio.PinIO {
+	if index < 0 || index >= len(d.pins) {
+		return gpio.INVALID
+	}
+	return d.pins[index]
+}
+
+// Pins returns the gpio.PinIO for all 16 pins, ordered from P00 to P17.
+func (d *Dev) Pins() []gpio.PinIO {
+	out := make([]gpio.PinIO, len(d.pins))
+	for i, p := range d.pins {
+		out[i] = p
+	}
+	return out
+}
+
+// PinByName returns the gpio.PinIO for the pin whose name, as returned by
+// Pin.Name, is name, e.g. an alias set with SetNames or PCF8575_0x20_P00. The
+// datasheet name, P00 to P17, is also accepted even if the pin has an alias.
+func (d *Dev) PinByName(name string) (gpio.PinIO, error) {
+	for i, p := range d.pins {
+		if p.Name() == name || fmt.Sprintf("P%d%d", i/8, i%8) == name {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("PCF8575.PinByName: unknown pin %q", name)
 }
 
+// SetDirection designates the pin at index as an output or an input.
+//
+// All the pins are outputs by default. An input pin is latched high so it can
+// be read, and is kept high: WriteOutput, Toggle and WriteIfChanged fail with
+// ErrDirection for this pin, and the writes of several pins, e.g. WriteAll,
+// WriteOutputs or ToggleMask, leave it high. This is a software guard only,
+// the device itself has no direction register.
+func (d *Dev) SetDirection(index int, out bool) error {
+	d.mu.Lock()
+	defer d.unlock()
+	if !d.port.Valid(index) {
+		return fmt.Errorf("PCF8575.SetDirection: %w (%d)", ErrPinRange, index)
+	}
+	if out {
+		d.inputs &^= 1 << uint(index)
+		return nil
+	}
+	d.inputs |= 1 << uint(index)
+	return d.commit(context.Background())
+}
+
+// Reserve claims the pin at index for owner, e.g. the name of a subsystem, so
+// that two parts of a program sharing the device don't use the same pin.
+//
+// It fails with ErrReserved, along the current owner, if the pin is already
+// reserved by another owner. Reserving a pin again for the same owner is a
+// no-op. The reservation is only checked by Reserve and Release: it is up to
+// the users of the pins to call Reserve first.
+func (d *Dev) Reserve(index int, owner string) error {
+	if owner == "" {
+		return errors.New("PCF8575.Reserve: owner must be set")
+	}
+	d.mu.Lock()
+	defer d.unlock()
+	if !d.port.Valid(index) {
+		return fmt.Errorf("PCF8575.Reserve: %w (%d)", ErrPinRange, index)
+	}
+	if o := d.owners[index]; o != "" && o != owner {
+		return fmt.Errorf("PCF8575.Reserve: %w by %q (%d)", ErrReserved, o, index)
+	}
+	d.owners[index] = owner
+	return nil
+}
+
+// Release releases the pin at index reserved by owner with Reserve.
+//
+// It fails with ErrReserved if the pin is reserved by another owner.
+// Releasing a pin not reserved is a no-op.
+func (d *Dev) Release(index int, owner string) error {
+	d.mu.Lock()
+	defer d.unlock()
+	if !d.port.Valid(index) {
+		return fmt.Errorf("PCF8575.Release: %w (%d)", ErrPinRange, index)
+	}
+	if o := d.owners[index]; o != "" && o != owner {
+		return fmt.Errorf("PCF8575.Release: %w by %q (%d)", ErrReserved, o, index)
+	}
+	d.owners[index] = ""
+	return nil
+}
+
+// Owner returns the owner of the pin at index set with Reserve, or "" if the
+// pin is not reserved or index is out of range.
+func (d *Dev) Owner(index int) string {
+	d.mu.Lock()
+	defer d.unlock()
+	if !d.port.Valid(index) {
+		return ""
+	}
+	return d.owners[index]
+}
+
+// SetInverted sets whether the pin at index has an inverted polarity.
+//
+// See SetInvertedMask.
+func (d *Dev) SetInverted(index int, inverted bool) error {
+	d.mu.Lock()
+	defer d.unlock()
+	if !d.port.Valid(index) {
+		return fmt.Errorf("PCF8575.SetInverted: %w (%d)", ErrPinRange, index)
+	}
+	if inverted {
+		d.inverted |= 1 << uint(index)
+	} else {
+		d.inverted &^= 1 << uint(index)
+	}
+	return nil
+}
+
+// SetInvertedMask sets the polarity of all the pins at once, a bit set to 1
+// inverts the corresponding pin. The bit ordering is the same as WriteAll.
+//
+// This is useful with active low loads like most relay boards, or with buttons
+// pulling the pins low. The inversion applies only at the API boundary:
+// WriteOutput, WriteOutputs, Toggle, WriteAll, ReadOutput, ReadInput, ReadAll,
+// the gpio.Group methods and the gpio.PinIO wrappers use logical levels while
+// the cached state and the bus carry the physical levels. Changing the
+// polarity does no I/O and doesn't change the physical outputs.
+//
+// The states passed to WithInitialState and WithSafeState, Reset, In and the
+// quasi-bidirectional semantics described in ReadInput are physical.
+func (d *Dev) SetInvertedMask(mask uint16) {
+	d.mu.Lock()
+	defer d.unlock()
+	d.inverted = mask
+}
+
+// WriteOutput sets the output of the pin at index in a single I²C
+// transaction, leaving the other outputs unchanged.
+//
+// The level is logical: SetInverted is applied to it, then WithPortInverted
+// on the bus. It returns ErrDirection for a pin set as input with
+// SetDirection. An index out of range is handled as set with
+// WithOutOfRangePolicy. A change sooner than allowed by WithPinRateLimit waits,
+// or fails with ErrRateLimited if WithRateLimitError is used. If writes are
+// being staged with Begin, the output is only staged.
 func (d *Dev) WriteOutput(index int, state bool) error {
-    if index >= 0 && index < 8 {
-        d.lowPins = setBit(d.lowPins, index, state)
-    } else if index >= 8 && index < 16 {
-        d.highPins = setBit(d.highPins, index - 8, state)
-    } else {
-        return errors.New(fmt.Sprintf("PCF8575.WriteOutput: Pin index out of range (%d)", index))
-    }
-    return d.updateState()
+	d.mu.Lock()
+	defer d.unlock()
+	if ok, err := d.checkRange("WriteOutput", index); !ok {
+		return err
+	}
+	return d.writeOutput(context.Background(), "WriteOutput", index, state)
+}
+
+// WriteOutputContext is the same as WriteOutput but gives up when ctx is
+// canceled.
+//
+// The I²C transaction itself can't be interrupted, ctx is checked before it and
+// between the attempts set with WithRetry. ctx.Err() is returned wrapped when
+// the write is abandoned, in which case the next write is always done like
+// after a failed write.
+func (d *Dev) WriteOutputContext(ctx context.Context, index int, state bool) error {
+	d.mu.Lock()
+	defer d.unlock()
+	if ok, err := d.checkRange("WriteOutputContext", index); !ok {
+		return err
+	}
+	return d.writeOutput(ctx, "WriteOutputContext", index, state)
+}
+
+// WriteOutputs sets the outputs of the pins in states, keyed by pin index, in
+// a single I²C transaction.
+//
+// All the indexes are validated first, so an invalid index leaves all the
+// outputs unchanged. The pins set as input with SetDirection stay high, like
+// with WriteAll.
+func (d *Dev) WriteOutputs(states map[int]bool) error {
+	return d.writeOutputs("WriteOutputs", states)
+}
+
+// SetMultiple sets the outputs of the pins in states, keyed by pin index, in
+// a single I²C transaction. The pins not in states are left untouched.
+//
+// It is the same as WriteOutputs: all the indexes are validated first, and it
+// doesn't read the inputs.
+func (d *Dev) SetMultiple(states map[int]bool) error {
+	return d.writeOutputs("SetMultiple", states)
+}
+
+// Toggle inverts the output of the pin at index and returns its new level.
+func (d *Dev) Toggle(index int) (bool, error) {
+	d.mu.Lock()
+	defer d.unlock()
+	if err := d.checkOutput("Toggle", index); err != nil {
+		return false, err
+	}
+	p := !d.port.Get(index)
+	d.port.Set(index, p)
+	return p != d.isInverted(index), d.commit(context.Background())
+}
+
+// Pulse drives the output of the pin at index to active for duration d, then
+// restores its previous level.
+//
+// The previous level is restored even if writing active fails or the
+// goroutine panics. This is useful to pulse a relay or a reset line.
+func (d *Dev) Pulse(index int, active bool, t time.Duration) (err error) {
+	d.mu.Lock()
+	if !d.port.Valid(index) {
+		d.unlock()
+		return fmt.Errorf("PCF8575.Pulse: %w (%d)", ErrPinRange, index)
+	}
+	prev := d.port.Get(index) != d.isInverted(index)
+	d.unlock()
+	defer func() {
+		if err1 := d.WriteOutput(index, prev); err == nil {
+			err = err1
+		}
+	}()
+	if err := d.WriteOutput(index, active); err != nil {
+		return err
+	}
+	time.Sleep(t)
+	return nil
+}
+
+// Flash inverts the output of the pin at index for onDur then restores it for
+// offDur, count times, e.g. to blink a status LED.
+//
+// The pin is left at its original level. If a write fails, restoring it is
+// attempted before returning the error.
+func (d *Dev) Flash(index int, count int, onDur, offDur time.Duration) (err error) {
+	d.mu.Lock()
+	if !d.port.Valid(index) {
+		d.unlock()
+		return fmt.Errorf("PCF8575.Flash: %w (%d)", ErrPinRange, index)
+	}
+	prev := d.port.Get(index) != d.isInverted(index)
+	d.unlock()
+	if count < 0 {
+		return fmt.Errorf("PCF8575.Flash: invalid count %d", count)
+	}
+	defer func() {
+		if err != nil {
+			d.WriteOutput(index, prev)
+		}
+	}()
+	for i := 0; i < count; i++ {
+		if err := d.WriteOutput(index, !prev); err != nil {
+			return err
+		}
+		time.Sleep(onDur)
+		if err := d.WriteOutput(index, prev); err != nil {
+			return err
+		}
+		if i != count-1 {
+			time.Sleep(offDur)
+		}
+	}
+	return nil
+}
+
+// Snapshot captures the cached output state and returns a function writing it
+// back in a single I²C transaction, e.g. around a self-test:
+//
+//	restore := d.Snapshot()
+//	defer restore()
+//
+// Only the first call of the returned function does a write, the following
+// ones return the same error. Snapshot itself doesn't do any I/O.
+func (d *Dev) Snapshot() func() error {
+	d.mu.Lock()
+	s := d.port.Word()
+	d.unlock()
+	var once sync.Once
+	var err error
+	return func() error {
+		once.Do(func() {
+			d.mu.Lock()
+			defer d.unlock()
+			d.port.SetWord(s)
+			err = d.commit(context.Background())
+		})
+		return err
+	}
+}
+
+// SelfTest latches each pin low in turn, the others being high, and reads the
+// pins back like SenseOutput, checking that only this pin reads low, e.g. as a
+// bring-up check of a board. It returns ErrVerify wrapped with the pin that
+// failed and the levels read.
+//
+// The caller must ensure that nothing connected to the pins drives them or
+// pulls them low, otherwise the test fails; a short between two pins is
+// reported. All the pins must be outputs, it returns ErrDirection otherwise.
+// SetInverted is ignored. The original output state is written back
+// afterward, even on failure.
+func (d *Dev) SelfTest() (err error) {
+	d.mu.Lock()
+	defer d.unlock()
+	if d.inputs != 0 {
+		return fmt.Errorf("PCF8575.SelfTest: %w (0x%04x)", ErrDirection, d.inputs)
+	}
+	prev := d.port.Word()
+	defer func() {
+		d.port.SetWord(prev)
+		if err1 := d.updateState(context.Background()); err == nil {
+			err = err1
+		}
+	}()
+	for i := 0; i < PinCount; i++ {
+		w := ^uint16(1 << uint(i))
+		d.port.SetWord(w)
+		if err := d.updateState(context.Background()); err != nil {
+			return err
+		}
+		if _, err := d.readState(context.Background()); err != nil {
+			return err
+		}
+		if d.lastRead != w {
+			return fmt.Errorf("PCF8575.SelfTest: %w on pin %d (read 0x%04x, expected 0x%04x)", ErrVerify, i, d.lastRead, w)
+		}
+	}
+	return nil
+}
+
+// CanSourceCurrent returns false: the pins latched high can't drive a load,
+// they only source SourceCurrent through their weak pull-up.
+//
+// It is meant for code handling different GPIO expanders, to decide whether a
+// load must be wired active low.
+func (d *Dev) CanSourceCurrent() bool {
+	return false
+}
+
+// Chase sets the pins in indices high one at a time, in order, the others
+// being low, waiting interval between each step and cycling until stop is
+// closed, e.g. to test a row of LEDs. Use SetInverted for active low LEDs.
+//
+// Each step is a single I²C transaction like WriteMask. The pins are set back
+// to their original levels when stop is closed or a write fails.
+func (d *Dev) Chase(indices []int, interval time.Duration, stop <-chan struct{}) (err error) {
+	if len(indices) == 0 {
+		return errors.New("PCF8575.Chase: no pins")
+	}
+	if interval <= 0 {
+		return fmt.Errorf("PCF8575.Chase: invalid interval %s", interval)
+	}
+	d.mu.Lock()
+	var mask uint16
+	for _, i := range indices {
+		if !d.port.Valid(i) {
+			d.unlock()
+			return fmt.Errorf("PCF8575.Chase: %w (%d)", ErrPinRange, i)
+		}
+		mask |= 1 << uint(i)
+	}
+	prev := d.port.Word() ^ d.inverted
+	d.unlock()
+	defer func() {
+		if err1 := d.WriteMask(mask, prev); err == nil {
+			err = err1
+		}
+	}()
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for n := 0; ; n = (n + 1) % len(indices) {
+		if err := d.WriteMask(mask, 1<<uint(indices[n])); err != nil {
+			return err
+		}
+		select {
+		case <-stop:
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+// WriteIfChanged sets the output of the pin at index only if it differs from
+// the cached state, and returns true if a write was done.
+//
+// The write is always done if the previous write failed, since the device
+// state is then unknown.
+func (d *Dev) WriteIfChanged(index int, state bool) (bool, error) {
+	d.mu.Lock()
+	defer d.unlock()
+	if err := d.checkOutput("WriteIfChanged", index); err != nil {
+		return false, err
+	}
+	p := state != d.isInverted(index)
+	if !d.dirty && d.port.Get(index) == p {
+		return false, nil
+	}
+	d.port.Set(index, p)
+	return true, d.commit(context.Background())
+}
+
+// WriteAllIfChanged is the WriteAll variant of WriteIfChanged.
+func (d *Dev) WriteAllIfChanged(state uint16) (bool, error) {
+	d.mu.Lock()
+	defer d.unlock()
+	p := state ^ d.inverted
+	if !d.dirty && d.port.Word() == p {
+		return false, nil
+	}
+	d.port.SetWord(p)
+	return true, d.commit(context.Background())
+}
+
+// WriteAll sets all 16 outputs in a single I²C transaction.
+//
+// Bit 0 is P00, bit 7 is P07, bit 8 is P10 and bit 15 is P17.
+func (d *Dev) WriteAll(state uint16) error {
+	d.mu.Lock()
+	defer d.unlock()
+	d.port.SetWord(state ^ d.inverted)
+	return d.commit(context.Background())
+}
+
+// WriteReadAll sets all 16 outputs like WriteAll and reads the level of all
+// 16 pins like ReadAll in a single I²C transaction.
+//
+// The two bytes written are followed by a repeated START and the two bytes
+// read, so no other controller can access the device in between. The PCF8575
+// applies each output byte at its acknowledge and samples the inputs at the
+// acknowledge of the read address, so the levels read already reflect the new
+// outputs, e.g. a pin just latched low reads low.
+//
+// If writes are being staged with Begin, the outputs are staged and only the
+// read is done.
+func (d *Dev) WriteReadAll(out uint16) (uint16, error) {
+	d.mu.Lock()
+	defer d.unlock()
+	// Keep the input pins latched high.
+	d.port.SetWord((out ^ d.inverted) | d.inputs)
+	if d.batch {
+		s, err := d.readState(context.Background())
+		if err != nil {
+			return 0, err
+		}
+		return pcf857x.Word(s) ^ d.inverted, nil
+	}
+	if err := d.rateLimit(context.Background()); err != nil {
+		d.dirty = true
+		return 0, fmt.Errorf("pcf8575: write output: %w", err)
+	}
+	s := []byte{0, 0}
+	atomic.AddUint64(&d.stats.Writes, 1)
+	atomic.AddUint64(&d.stats.Reads, 1)
+	w := d.wireState()
+	err := d.tx(context.Background(), w, s)
+	d.addTrace("writeread", w, s, err)
+	d.dirty = err != nil
+	if err != nil {
+		return 0, fmt.Errorf("pcf8575: write output: %w", err)
+	}
+	d.fromWire(s)
+	d.wrote()
+	d.lastRead = pcf857x.Word(s)
+	if m := d.mismatch(); d.verify && m != 0 {
+		return 0, fmt.Errorf("pcf8575: write output: %w (0x%04x)", ErrVerify, m)
+	}
+	return d.lastRead ^ d.inverted, nil
+}
+
+// Update calls fn with the output state and writes the state it returns in a
+// single I²C transaction, with the Dev locked so no other write can happen in
+// between. It returns the new output state.
+//
+// The state is the output latch, like ReadOutput, not the live levels of the
+// pins. The bit ordering is the same as WriteAll. fn must not call the Dev.
+func (d *Dev) Update(fn func(state uint16) uint16) (uint16, error) {
+	d.mu.Lock()
+	defer d.unlock()
+	d.port.SetWord(fn(d.port.Word()^d.inverted) ^ d.inverted)
+	err := d.commit(context.Background())
+	return d.port.Word() ^ d.inverted, err
+}
+
+// SetPins sets the outputs selected by mask high in a single I²C transaction,
+// leaving the other outputs unchanged.
+func (d *Dev) SetPins(mask uint16) error {
+	return d.WriteMask(mask, 0xffff)
+}
+
+// ClearPins sets the outputs selected by mask low in a single I²C
+// transaction, leaving the other outputs unchanged.
+func (d *Dev) ClearPins(mask uint16) error {
+	return d.WriteMask(mask, 0)
+}
+
+// ToggleMask inverts the outputs selected by mask in a single I²C transaction
+// and returns the new output state.
+//
+// The bit ordering is the same as WriteAll: bit 0 is P00 and bit 15 is P17.
+// The returned state takes SetInverted into account, like ReadOutput. Unlike
+// Toggle, it doesn't fail for the pins set as input with SetDirection, they
+// stay high like with the other writes of several pins.
+func (d *Dev) ToggleMask(mask uint16) (uint16, error) {
+	d.mu.Lock()
+	defer d.unlock()
+	d.port.SetWord(d.port.Word() ^ mask)
+	err := d.commit(context.Background())
+	return d.port.Word() ^ d.inverted, err
 }
 
+// ToggleIndices inverts the outputs of the pins at indices in a single I²C
+// transaction and returns the new output state, like ToggleMask.
+//
+// All the indexes are validated first, so an invalid index leaves all the
+// outputs unchanged. A pin listed more than once is inverted once. Unlike
+// Toggle, the pins set as input with SetDirection stay high instead of failing
+// with ErrDirection.
+func (d *Dev) ToggleIndices(indices ...int) (uint16, error) {
+	var mask uint16
+	for _, i := range indices {
+		if !d.port.Valid(i) {
+			return 0, fmt.Errorf("PCF8575.ToggleIndices: %w (%d)", ErrPinRange, i)
+		}
+		mask |= 1 << uint(i)
+	}
+	return d.ToggleMask(mask)
+}
+
+// ToggleAll inverts all the outputs in a single I²C transaction and returns the
+// new output state, e.g. to blink all the LEDs of a test pattern.
+//
+// It is the same as ToggleMask(0xFFFF). Inverting a pin flips both its
+// physical and logical level so SetInverted doesn't change what is written;
+// the returned state takes it into account like ReadOutput. The pins set as
+// input with SetDirection stay high.
+func (d *Dev) ToggleAll() (uint16, error) {
+	return d.ToggleMask(0xffff)
+}
+
+// GetState returns the cached output latch, e.g. to restore it later with
+// SetState.
+//
+// Unlike ReadAll, which reads the live levels of the pins, it doesn't do any
+// I/O. The state is physical, regardless of SetInverted.
+func (d *Dev) GetState() uint16 {
+	d.mu.Lock()
+	defer d.unlock()
+	return d.port.Word()
+}
+
+// SetState writes the output latch in a single I²C transaction, e.g. a state
+// saved with GetState.
+//
+// The state is physical, regardless of SetInverted. The bit ordering is the
+// same as WriteAll.
+func (d *Dev) SetState(state uint16) error {
+	d.mu.Lock()
+	defer d.unlock()
+	d.port.SetWord(state)
+	return d.commit(context.Background())
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+//
+// It encodes the cached output state, the polarity set with SetInverted and
+// the directions set with SetDirection, e.g. to save a preset across restarts.
+// It doesn't do any I/O.
+func (d *Dev) MarshalBinary() ([]byte, error) {
+	d.mu.Lock()
+	defer d.unlock()
+	b := make([]byte, stateSize)
+	b[0] = stateVersion
+	binary.LittleEndian.PutUint16(b[1:], d.port.Word())
+	binary.LittleEndian.PutUint16(b[3:], d.inverted)
+	binary.LittleEndian.PutUint16(b[5:], d.inputs)
+	return b, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+//
+// It restores the state encoded by MarshalBinary without doing any I/O. The
+// outputs are written by the next write, e.g. SetState(d.GetState()).
+func (d *Dev) UnmarshalBinary(b []byte) error {
+	if len(b) == 0 || b[0] != stateVersion {
+		return errors.New("pcf8575: unsupported state version")
+	}
+	if len(b) != stateSize {
+		return fmt.Errorf("pcf8575: invalid state length %d", len(b))
+	}
+	d.mu.Lock()
+	defer d.unlock()
+	d.port.SetWord(binary.LittleEndian.Uint16(b[1:]))
+	d.inverted = binary.LittleEndian.Uint16(b[3:])
+	d.inputs = binary.LittleEndian.Uint16(b[5:])
+	// The device doesn't match the cache anymore.
+	d.dirty = true
+	return nil
+}
+
+// WriteMask sets the outputs selected by mask to the corresponding bits in
+// values in a single I²C transaction, leaving the other outputs unchanged.
+//
+// The bit ordering is the same as WriteAll.
+func (d *Dev) WriteMask(mask, values uint16) error {
+	d.mu.Lock()
+	defer d.unlock()
+	d.port.SetWord(d.port.Word()&^mask | (values^d.inverted)&mask)
+	return d.commit(context.Background())
+}
+
+// WriteMaskSequence sets the outputs selected by mask to each of values in
+// turn in a single I²C transaction, leaving the other outputs unchanged.
+//
+// The device latches each state as it is received, 2 bytes per state, so the
+// consecutive states are apart by the time it takes to send 2 bytes, e.g.
+// 180µs at 100kHz. This is how a strobe is pulsed, e.g. the EN pin of an LCD.
+// The bit ordering is the same as WriteAll.
+//
+// The rate limit set with WithPinRateLimit only applies to the last state. If
+// writes are being staged with Begin, only the last state is staged.
+func (d *Dev) WriteMaskSequence(mask uint16, values []uint16) error {
+	if len(values) == 0 {
+		return errors.New("PCF8575.WriteMaskSequence: no states")
+	}
+	d.mu.Lock()
+	defer d.unlock()
+	// Keep the input pins latched high.
+	set := func(base, v uint16) {
+		d.port.SetWord(base&^mask | (v^d.inverted)&mask | d.inputs)
+	}
+	set(d.port.Word(), values[len(values)-1])
+	if d.batch {
+		return nil
+	}
+	if err := d.rateLimit(context.Background()); err != nil {
+		d.dirty = true
+		return fmt.Errorf("pcf8575: write output: %w", err)
+	}
+	last := d.port.Word()
+	w := make([]byte, 0, 2*len(values))
+	for _, v := range values {
+		set(last, v)
+		w = append(w, d.wireState()...)
+	}
+	atomic.AddUint64(&d.stats.Writes, 1)
+	err := d.tx(context.Background(), w, nil)
+	d.addTrace("write", w, nil, err)
+	d.dirty = err != nil
+	if err != nil {
+		return fmt.Errorf("pcf8575: write output: %w", err)
+	}
+	d.wrote()
+	if d.verify {
+		if _, err := d.readState(context.Background()); err != nil {
+			return err
+		}
+		if m := d.mismatch(); m != 0 {
+			return fmt.Errorf("pcf8575: write output: %w (0x%04x)", ErrVerify, m)
+		}
+	}
+	return nil
+}
+
+// ReadOutputLatch returns the output latch of the pin at index, as last
+// written.
+//
+// The PCF8575 has no way to read back its latch: reading the port returns the
+// live levels of the pins, see ReadInput. The cached value is thus
+// authoritative and no I/O is done. The level takes SetInverted into account.
+func (d *Dev) ReadOutputLatch(index int) (bool, error) {
+	d.mu.Lock()
+	defer d.unlock()
+	if ok, err := d.checkRange("ReadOutputLatch", index); !ok {
+		return false, err
+	}
+	return d.port.Get(index) != d.isInverted(index), nil
+}
+
+// ReadOutput returns the output latch of the pin at index without doing any
+// I/O.
+//
+// It is the same as ReadOutputLatch, which is clearer about the semantics.
 func (d *Dev) ReadOutput(index int) (bool, error) {
-    if index >= 0 && index < 8 {
-        return getBit(d.lowPins, index), nil
-    } else if index >= 8 && index < 16 {
-        return getBit(d.highPins, index - 8), nil
-    } else {
-        return false, errors.New(fmt.Sprintf("PCF8575.ReadOutput: Pin index out of range (%d)", index))
-    }
+	l, err := d.ReadOutputLatch(index)
+	if err != nil {
+		return false, fmt.Errorf("PCF8575.ReadOutput: %w (%d)", ErrPinRange, index)
+	}
+	return l, nil
+}
+
+// SenseOutput reads the live level of the output pin at index on the bus, e.g.
+// to detect a short or an external circuit fighting the weak pull-up.
+//
+// Unlike ReadOutput, which returns the cached latch, it does an I²C
+// transaction. Unlike ReadInput, the pin is expected to be an output: it
+// returns ErrDirection for a pin set as input with SetDirection and no error
+// for a pin latched low. It is only meaningful for the pins latched high,
+// since a pin latched low always reads low; a pin latched high reading low is
+// pulled low externally. The level takes SetInverted into account.
+func (d *Dev) SenseOutput(index int) (bool, error) {
+	d.mu.Lock()
+	defer d.unlock()
+	if err := d.checkOutput("SenseOutput", index); err != nil {
+		return false, err
+	}
+	s, err := d.readState(context.Background())
+	if err != nil {
+		return false, err
+	}
+	return pcf857x.GetBit(s[index/8], index%8) != d.isInverted(index), nil
 }
 
+// ReadInput reads the live level of the pin at index on the bus.
+//
+// The pins are quasi-bidirectional: a pin can only be used as an input when
+// its output is latched high, so that the external circuit can pull it low
+// against the weak internal pull-up. A pin latched low always reads low; in
+// this case ErrLatchedLow is returned along the level. Use In to latch the pin
+// high first.
 func (d *Dev) ReadInput(index int) (bool, error) {
-    s, err := d.readState()
-    if err != nil {
-        return false, err
-    }
-    if index >= 0 && index < 8 {
-        return getBit(s[0], index), nil
-    } else if index >= 8 && index < 16 {
-        return getBit(s[1], index - 8), nil
-    } else {
-        return false, errors.New(fmt.Sprintf("PCF8575.ReadInput: Pin index out of range (%d)", index))
-    }
+	d.mu.Lock()
+	defer d.unlock()
+	if ok, err := d.checkRange("ReadInput", index); !ok {
+		return false, err
+	}
+	return d.readInput(context.Background(), index)
+}
+
+// ReadInputContext is the same as ReadInput but gives up when ctx is canceled.
+//
+// See WriteOutputContext for when ctx is checked.
+func (d *Dev) ReadInputContext(ctx context.Context, index int) (bool, error) {
+	d.mu.Lock()
+	defer d.unlock()
+	if ok, err := d.checkRange("ReadInputContext", index); !ok {
+		return false, err
+	}
+	return d.readInput(ctx, index)
 }
 
-func (d *Dev) readState() ([]byte, error) {
-    s := []byte {0, 0}
-    err := d.c.Tx(nil, s)
-    return s, err
+// In latches the pin at index high if needed, then reads its level.
+//
+// See ReadInput for the quasi-bidirectional semantics.
+func (d *Dev) In(index int) (bool, error) {
+	d.mu.Lock()
+	defer d.unlock()
+	if !d.port.Valid(index) {
+		return false, fmt.Errorf("PCF8575.In: %w (%d)", ErrPinRange, index)
+	}
+	if err := d.latchHigh(context.Background(), index); err != nil {
+		return false, err
+	}
+	return d.readInput(context.Background(), index)
+}
+
+// Begin starts staging writes.
+//
+// Until Flush is called, WriteOutput, WriteAll and the gpio.PinIO wrappers
+// only update the cached output state and do not do any I/O. Reads are not
+// affected: ReadInput and ReadAll still do an immediate I²C transaction.
+func (d *Dev) Begin() {
+	d.mu.Lock()
+	defer d.unlock()
+	d.batch = true
+}
+
+// Flush writes the staged output state in a single I²C transaction and stops
+// staging writes.
+//
+// If the write fails, the staged state is kept and writes are still staged so
+// Flush can be retried.
+func (d *Dev) Flush() error {
+	d.mu.Lock()
+	defer d.unlock()
+	if err := d.updateState(context.Background()); err != nil {
+		return err
+	}
+	d.batch = false
+	return nil
+}
+
+// ReadAll reads the level of all 16 pins in a single I²C transaction.
+//
+// The bit ordering is the same as WriteAll: bit 0 is P00 and bit 15 is P17.
+func (d *Dev) ReadAll() (uint16, error) {
+	d.mu.Lock()
+	defer d.unlock()
+	s, err := d.readState(context.Background())
+	if err != nil {
+		return 0, err
+	}
+	return pcf857x.Word(s) ^ d.inverted, nil
+}
+
+// ReadInputMask reads all 16 pins in a single I²C transaction like ReadAll
+// and returns only the levels of the pins selected by mask, the other bits
+// being 0.
+func (d *Dev) ReadInputMask(mask uint16) (uint16, error) {
+	v, err := d.ReadAll()
+	return v & mask, err
+}
+
+// ReadField reads the width pins starting at startIndex in a single I²C
+// transaction and returns their levels as an integer, startIndex being the
+// least significant bit, e.g. for a selector switch wired to adjacent pins.
+func (d *Dev) ReadField(startIndex, width int) (uint, error) {
+	m, err := fieldMask("ReadField", startIndex, width)
+	if err != nil {
+		return 0, err
+	}
+	v, err := d.ReadAll()
+	return uint(v&m) >> uint(startIndex), err
+}
+
+// WriteField sets the width outputs starting at startIndex to value in a
+// single I²C transaction, startIndex being the least significant bit, leaving
+// the other outputs unchanged.
+//
+// It fails with ErrValueOverflow if value doesn't fit in width bits, rather
+// than truncating it silently.
+func (d *Dev) WriteField(startIndex, width int, value uint) error {
+	m, err := fieldMask("WriteField", startIndex, width)
+	if err != nil {
+		return err
+	}
+	if value>>uint(width) != 0 {
+		return fmt.Errorf("PCF8575.WriteField: %w (%d in %d bits)", ErrValueOverflow, value, width)
+	}
+	return d.WriteMask(m, uint16(value<<uint(startIndex)))
+}
+
+// DefineGroup defines a group of pins, possibly not adjacent, read and written
+// as an integer with ReadGroup and WriteGroup, indices[0] being the least
+// significant bit, e.g. an address bus. It replaces any group with the same
+// name.
+//
+// It doesn't do any I/O.
+func (d *Dev) DefineGroup(name string, indices []int) error {
+	if name == "" {
+		return errors.New("PCF8575.DefineGroup: empty name")
+	}
+	if len(indices) == 0 {
+		return fmt.Errorf("PCF8575.DefineGroup: group %q has no pins", name)
+	}
+	var m uint16
+	for _, i := range indices {
+		if !d.port.Valid(i) {
+			return fmt.Errorf("PCF8575.DefineGroup: %w (%d)", ErrPinRange, i)
+		}
+		if m&(1<<uint(i)) != 0 {
+			return fmt.Errorf("PCF8575.DefineGroup: pin %d used twice", i)
+		}
+		m |= 1 << uint(i)
+	}
+	d.mu.Lock()
+	defer d.unlock()
+	if d.groups == nil {
+		d.groups = map[string][]int{}
+	}
+	d.groups[name] = append([]int(nil), indices...)
+	return nil
+}
+
+// ReadGroup reads the pins of the group defined with DefineGroup in a single
+// I²C transaction and returns their levels as an integer, like ReadField.
+func (d *Dev) ReadGroup(name string) (uint, error) {
+	d.mu.Lock()
+	indices, ok := d.groups[name]
+	d.unlock()
+	if !ok {
+		return 0, fmt.Errorf("PCF8575.ReadGroup: unknown group %q", name)
+	}
+	v, err := d.ReadAll()
+	var out uint
+	for b, i := range indices {
+		if v&(1<<uint(i)) != 0 {
+			out |= 1 << uint(b)
+		}
+	}
+	return out, err
+}
+
+// WriteGroup sets the outputs of the group defined with DefineGroup to value
+// in a single I²C transaction, leaving the other outputs unchanged, like
+// WriteField.
+func (d *Dev) WriteGroup(name string, value uint) error {
+	d.mu.Lock()
+	indices, ok := d.groups[name]
+	d.unlock()
+	if !ok {
+		return fmt.Errorf("PCF8575.WriteGroup: unknown group %q", name)
+	}
+	if value>>uint(len(indices)) != 0 {
+		return fmt.Errorf("PCF8575.WriteGroup: %w (%d in %d bits)", ErrValueOverflow, value, len(indices))
+	}
+	var m, v uint16
+	for b, i := range indices {
+		m |= 1 << uint(i)
+		if value&(1<<uint(b)) != 0 {
+			v |= 1 << uint(i)
+		}
+	}
+	return d.WriteMask(m, v)
+}
+
+// ReadRaw reads the two bytes of the port as returned by the device: the first
+// one is P00 to P07, the second one is P10 to P17.
+//
+// It is a debugging escape hatch below ReadAll: SetInverted, SetDirection
+// and WithPortInverted are deliberately ignored.
+func (d *Dev) ReadRaw() ([2]byte, error) {
+	d.mu.Lock()
+	defer d.unlock()
+	var out [2]byte
+	s, err := d.readState(context.Background())
+	if err != nil {
+		return out, err
+	}
+	copy(out[:], s)
+	// Undo the inversion done by readState.
+	d.fromWire(out[:])
+	return out, nil
 }
 
-func (d *Dev) updateState() error {
-    return d.c.Tx([]byte{d.lowPins, d.highPins}, nil)
+// Out implements gpio.Group.
+//
+// The pins selected by mask are set to the corresponding bit in values, the
+// other pins keep their current output state, like WriteMask.
+func (d *Dev) Out(mask, values gpio.GPIOValue) error {
+	if mask>>16 != 0 {
+		return fmt.Errorf("PCF8575.Out: %w (mask 0x%x)", ErrPinRange, uint64(mask))
+	}
+	return d.WriteMask(uint16(mask), uint16(values))
 }
 
-func setBit(value byte, index int, state bool) byte {
-    if state {
-        return value | getMask(index)
-    } else {
-        return value & ^getMask(index)
-    }
+// Read implements gpio.Group.
+//
+// It reads all the pins in a single I²C transaction, like ReadAll, and
+// returns the levels of the pins selected by mask.
+func (d *Dev) Read(mask gpio.GPIOValue) (gpio.GPIOValue, error) {
+	if mask>>16 != 0 {
+		return 0, fmt.Errorf("PCF8575.Read: %w (mask 0x%x)", ErrPinRange, uint64(mask))
+	}
+	v, err := d.ReadAll()
+	if err != nil {
+		return 0, err
+	}
+	return gpio.GPIOValue(v) & mask, nil
 }
 
-func getBit(value byte, index int) bool {
-    return value & getMask(index) > 0
+// ReadInputs reads the level of all 16 pins in a single I²C transaction.
+//
+// Index 0 is P00 and index 15 is P17, as with ReadInput.
+func (d *Dev) ReadInputs() ([PinCount]bool, error) {
+	var out [PinCount]bool
+	v, err := d.ReadAll()
+	if err != nil {
+		return out, err
+	}
+	for i := range out {
+		out[i] = v&(1<<uint(i)) != 0
+	}
+	return out, nil
 }
 
-func getMask(index int) byte {
-    return 1 << byte(index)
+// WaitForEdge waits for an input to change and returns the index of the pin
+// that changed and its new level.
+//
+// It requires the INT pin, see WithInterruptPin. Changes are compared against
+// the levels reported by the previous calls, so when multiple pins change at
+// once, the following calls return immediately with the remaining changes,
+// lowest index first.
+//
+// Returns -1, false, nil if no change happened before the timeout. Specify -1
+// to effectively disable timeout.
+func (d *Dev) WaitForEdge(timeout time.Duration) (int, bool, error) {
+	if d.intPin == nil {
+		return -1, false, errors.New("pcf8575: WaitForEdge requires the INT pin")
+	}
+	var deadline time.Time
+	if timeout >= 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	d.mu.Lock()
+	if !d.edgeInit {
+		if _, err := d.readState(context.Background()); err != nil {
+			d.unlock()
+			return -1, false, err
+		}
+		d.reported = d.lastRead
+		d.edgeInit = true
+	}
+	d.unlock()
+	for {
+		d.mu.Lock()
+		if diff := d.lastRead ^ d.reported; diff != 0 {
+			i := 0
+			for diff&1 == 0 {
+				diff >>= 1
+				i++
+			}
+			d.reported ^= 1 << uint(i)
+			l := (d.lastRead^d.inverted)&(1<<uint(i)) != 0
+			d.unlock()
+			return i, l, nil
+		}
+		d.unlock()
+		t := time.Duration(-1)
+		if timeout >= 0 {
+			if t = deadline.Sub(time.Now()); t < 0 {
+				return -1, false, nil
+			}
+		}
+		if !d.intPin.WaitForEdge(t) {
+			return -1, false, nil
+		}
+		d.mu.Lock()
+		_, err := d.readState(context.Background())
+		d.unlock()
+		if err != nil {
+			return -1, false, err
+		}
+	}
 }
 
+// WaitForPinEdge waits for the input of the pin at index to change according
+// to edge and returns true, or false if no such change happened before the
+// timeout. Specify -1 to effectively disable timeout.
+//
+// Unlike WaitForEdge, it doesn't require the INT pin: without it, the pin is
+// read at the interval set with WithPollInterval, each read being an I²C
+// transaction, see WithPollInterval for the cost. With the INT pin, the pin
+// is only read when INT signals a change.
+func (d *Dev) WaitForPinEdge(index int, edge gpio.Edge, timeout time.Duration) (bool, error) {
+	if !d.port.Valid(index) {
+		return false, fmt.Errorf("PCF8575.WaitForPinEdge: %w (%d)", ErrPinRange, index)
+	}
+	if edge != gpio.RisingEdge && edge != gpio.FallingEdge && edge != gpio.BothEdges {
+		return false, fmt.Errorf("PCF8575.WaitForPinEdge: invalid edge %s", edge)
+	}
+	var deadline time.Time
+	if timeout >= 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	l, err := d.readPin(index)
+	if err != nil {
+		return false, err
+	}
+	for {
+		t := time.Duration(-1)
+		if timeout >= 0 {
+			if t = deadline.Sub(time.Now()); t < 0 {
+				return false, nil
+			}
+		}
+		if d.intPin != nil {
+			if !d.intPin.WaitForEdge(t) {
+				return false, nil
+			}
+		} else {
+			if t < 0 || t > d.pollInterval {
+				t = d.pollInterval
+			}
+			time.Sleep(t)
+		}
+		n, err := d.readPin(index)
+		if err != nil {
+			return false, err
+		}
+		if n != l && (edge == gpio.BothEdges || (edge == gpio.RisingEdge) == n) {
+			return true, nil
+		}
+		l = n
+	}
+}
+
+// register registers all the pins and the Dev as a group in gpioreg, rolling
+// back on failure.
+func (d *Dev) register() error {
+	for i, p := range d.pins {
+		if err := gpioreg.Register(p, false); err != nil {
+			for _, r := range d.pins[:i] {
+				gpioreg.Unregister(r.Name())
+			}
+			return fmt.Errorf("pcf8575: %v", err)
+		}
+	}
+	if err := gpioreg.RegisterGroup(d.groupName(), d); err != nil {
+		for _, r := range d.pins {
+			gpioreg.Unregister(r.Name())
+		}
+		return fmt.Errorf("pcf8575: %v", err)
+	}
+	d.registered = true
+	return nil
+}
+
+// groupName returns the name of the Dev in gpioreg, e.g. PCF8575_0x20.
+func (d *Dev) groupName() string {
+	return fmt.Sprintf("PCF8575_0x%02x", d.addr)
+}
+
+// unregister removes the pins from gpioreg if they were registered.
+func (d *Dev) unregister() error {
+	if !d.registered {
+		return nil
+	}
+	d.registered = false
+	err := gpioreg.UnregisterGroup(d.groupName())
+	for _, p := range d.pins {
+		if err1 := gpioreg.Unregister(p.Name()); err1 != nil && err == nil {
+			err = err1
+		}
+	}
+	return err
+}
+
+// readPin locks the Dev and reads the level of a valid pin index, regardless
+// of the policy set with WithOutOfRangePolicy.
+func (d *Dev) readPin(index int) (bool, error) {
+	d.mu.Lock()
+	defer d.unlock()
+	return d.readInput(context.Background(), index)
+}
+
+// readInput reads the level of a valid pin index.
+func (d *Dev) readInput(ctx context.Context, index int) (bool, error) {
+	s, err := d.readState(ctx)
+	if err != nil {
+		return false, err
+	}
+	l := pcf857x.GetBit(s[index/8], index%8) != d.isInverted(index)
+	if !d.latchedHigh(index) {
+		return l, fmt.Errorf("PCF8575.ReadInput: %w (%d)", ErrLatchedLow, index)
+	}
+	return l, nil
+}
+
+// writeOutput sets the output of the pin at index.
+func (d *Dev) writeOutput(ctx context.Context, method string, index int, state bool) error {
+	if err := d.checkOutput(method, index); err != nil {
+		return err
+	}
+	d.port.Set(index, state != d.isInverted(index))
+	return d.commit(ctx)
+}
+
+// writeOutputs implements WriteOutputs and SetMultiple.
+func (d *Dev) writeOutputs(method string, states map[int]bool) error {
+	d.mu.Lock()
+	defer d.unlock()
+	for i := range states {
+		if !d.port.Valid(i) {
+			return fmt.Errorf("PCF8575.%s: %w (%d)", method, ErrPinRange, i)
+		}
+	}
+	for i, l := range states {
+		d.port.Set(i, l != d.isInverted(i))
+	}
+	return d.commit(context.Background())
+}
+
+// latchHigh immediately latches the valid pin index physically high, if it
+// isn't already.
+func (d *Dev) latchHigh(ctx context.Context, index int) error {
+	if d.latchedHigh(index) {
+		return nil
+	}
+	d.setWire(index, true)
+	if err := d.updateState(ctx); err != nil {
+		d.setWire(index, false)
+		return err
+	}
+	return nil
+}
+
+// trace is a transaction to report to the tracer set with WithTracer.
+type trace struct {
+	op   string
+	w, r []byte
+	err  error
+}
+
+// unlock releases d.mu, then reports the transactions done while it was held
+// to the tracer.
+func (d *Dev) unlock() {
+	t := d.traces
+	d.traces = nil
+	d.mu.Unlock()
+	for _, e := range t {
+		d.tracer(e.op, e.w, e.r, e.err)
+	}
+}
+
+// addTrace queues a transaction for the tracer, if any.
+func (d *Dev) addTrace(op string, w, r []byte, err error) {
+	if d.tracer != nil {
+		d.traces = append(d.traces, trace{op, append([]byte(nil), w...), append([]byte(nil), r...), err})
+	}
+}
+
+// logf calls the logger set with WithLogger, if any.
+func (d *Dev) logf(format string, args ...interface{}) {
+	if d.logger != nil {
+		d.logger(format, args...)
+	}
+}
+
+// fieldMask returns the mask of the width pins starting at startIndex.
+func fieldMask(method string, startIndex, width int) (uint16, error) {
+	if startIndex < 0 || width < 1 || startIndex+width > PinCount {
+		return 0, fmt.Errorf("PCF8575.%s: %w (%d, width %d)", method, ErrPinRange, startIndex, width)
+	}
+	return uint16((uint32(1)<<uint(width) - 1) << uint(startIndex)), nil
+}
+
+// level returns l as read in a datasheet.
+func level(l bool) string {
+	if l {
+		return "high"
+	}
+	return "low"
+}
+
+// isInverted returns true if the pin at index has an inverted polarity.
+func (d *Dev) isInverted(index int) bool {
+	return d.inverted&(1<<uint(index)) != 0
+}
+
+// checkRange returns true if index is valid, otherwise the error to return
+// according to the policy set with WithOutOfRangePolicy.
+func (d *Dev) checkRange(method string, index int) (bool, error) {
+	if d.port.Valid(index) {
+		return true, nil
+	}
+	switch d.rangePolicy {
+	case OutOfRangeIgnore:
+		return false, nil
+	case OutOfRangePanic:
+		panic(fmt.Sprintf("PCF8575.%s: %s (%d)", method, ErrPinRange, index))
+	}
+	return false, fmt.Errorf("PCF8575.%s: %w (%d)", method, ErrPinRange, index)
+}
+
+// checkOutput returns an error if index is not a valid output pin.
+func (d *Dev) checkOutput(method string, index int) error {
+	if !d.port.Valid(index) {
+		return fmt.Errorf("PCF8575.%s: %w (%d)", method, ErrPinRange, index)
+	}
+	if d.inputs&(1<<uint(index)) != 0 {
+		return fmt.Errorf("PCF8575.%s: %w (%d)", method, ErrDirection, index)
+	}
+	return nil
+}
+
+// commit writes the cached output state unless writes are being staged.
+func (d *Dev) commit(ctx context.Context) error {
+	// Keep the input pins latched high.
+	d.port.SetWord(d.port.Word() | d.inputs)
+	if d.batch {
+		return nil
+	}
+	return d.updateState(ctx)
+}
+
+// tx does an I²C transaction, retrying as set with WithRetry and WithBackoff.
+//
+// The transactions are idempotent: a write sends the whole cached state.
+//
+// ctx is checked before each attempt.
+func (d *Dev) tx(ctx context.Context, w, r []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b := d.backoffFn
+	if b == nil {
+		b = ExponentialBackoff{Initial: d.backoff}
+	}
+	err := d.c.Tx(w, r)
+	for i := 1; i < d.attempts && err != nil; i++ {
+		delay := b.Delay(i)
+		d.logf("pcf8575 0x%02x: retry %d/%d in %s: %v", d.addr, i, d.attempts-1, delay, err)
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+		atomic.AddUint64(&d.stats.Retries, 1)
+		err = d.c.Tx(w, r)
+	}
+	if err == nil {
+		err = d.reinit(w, r)
+	}
+	if err != nil {
+		atomic.AddUint64(&d.stats.Errors, 1)
+		d.failures++
+	} else {
+		d.failures = 0
+	}
+	if err != nil && d.attempts > 1 {
+		return fmt.Errorf("%d attempts: %w", d.attempts, err)
+	}
+	return err
+}
+
+// reinit writes the cached output state after the consecutive failures set
+// with WithAutoReinit, in case the device was power cycled, then does the read
+// r again so it reflects the restored outputs.
+//
+// Writes don't need it since they send the whole cached state. Staged writes
+// are left to Flush.
+func (d *Dev) reinit(w, r []byte) error {
+	if d.reinitAfter == 0 || d.failures < d.reinitAfter || len(w) != 0 || d.batch {
+		return nil
+	}
+	d.logf("pcf8575 0x%02x: restoring the outputs after %d failures", d.addr, d.failures)
+	atomic.AddUint64(&d.stats.Writes, 1)
+	w1 := d.wireState()
+	err := d.c.Tx(w1, nil)
+	d.addTrace("write", w1, nil, err)
+	if err != nil {
+		return err
+	}
+	d.wrote()
+	d.dirty = false
+	return d.c.Tx(w, r)
+}
+
+func (d *Dev) readState(ctx context.Context) ([]byte, error) {
+	s := []byte{0, 0}
+	atomic.AddUint64(&d.stats.Reads, 1)
+	err := d.tx(ctx, nil, s)
+	d.addTrace("read", nil, s, err)
+	if err != nil {
+		return s, fmt.Errorf("pcf8575: read input: %w", err)
+	}
+	d.fromWire(s)
+	d.lastRead = pcf857x.Word(s)
+	return s, nil
+}
+
+// wireState returns the cached output state as sent on the bus, inverted if
+// WithPortInverted is used. The input pins are always latched high on the bus.
+func (d *Dev) wireState() []byte {
+	if !d.portInverted {
+		return d.port.State
+	}
+	return []byte{^d.port.State[0] | byte(d.inputs), ^d.port.State[1] | byte(d.inputs>>8)}
+}
+
+// powerOn returns the cached output state matching the device's power-on
+// state, all the pins high on the bus.
+func (d *Dev) powerOn() uint16 {
+	if d.portInverted {
+		return 0
+	}
+	return 0xffff
+}
+
+// latchedHigh returns true if the pin at index is latched high on the bus, so
+// that it can be read.
+func (d *Dev) latchedHigh(index int) bool {
+	return pcf857x.Word(d.wireState())&(1<<uint(index)) != 0
+}
+
+// setWire sets the cached output of the pin at index so it is latched high or
+// low on the bus.
+func (d *Dev) setWire(index int, high bool) {
+	d.port.Set(index, high != d.portInverted)
+}
+
+// mismatch returns the pins latched low on the bus that didn't read back low
+// in the last read.
+func (d *Dev) mismatch() uint16 {
+	r := d.lastRead
+	if d.portInverted {
+		r = ^r
+	}
+	return ^pcf857x.Word(d.wireState()) & r
+}
+
+// fromWire converts in place the bytes read on the bus to the levels of the
+// pins, inverted if WithPortInverted is used.
+func (d *Dev) fromWire(s []byte) {
+	if d.portInverted {
+		s[0], s[1] = ^s[0], ^s[1]
+	}
+}
+
+// updateState writes the cached output state, which is then dirty until a
+// write succeeds.
+func (d *Dev) updateState(ctx context.Context) error {
+	err := d.writeState(ctx)
+	d.dirty = err != nil
+	return err
+}
+
+func (d *Dev) writeState(ctx context.Context) error {
+	if err := d.rateLimit(ctx); err != nil {
+		return fmt.Errorf("pcf8575: write output: %w", err)
+	}
+	atomic.AddUint64(&d.stats.Writes, 1)
+	w := d.wireState()
+	err := d.tx(ctx, w, nil)
+	d.addTrace("write", w, nil, err)
+	if err != nil {
+		return fmt.Errorf("pcf8575: write output: %w", err)
+	}
+	d.wrote()
+	if d.verify {
+		if _, err := d.readState(ctx); err != nil {
+			return err
+		}
+		// Only the pins latched low are driven, the others read the external
+		// level.
+		if m := d.mismatch(); m != 0 {
+			return fmt.Errorf("pcf8575: write output: %w (0x%04x)", ErrVerify, m)
+		}
+	}
+	return nil
+}
+
+// rateLimit waits until the pins about to change are allowed to change as set
+// with WithPinRateLimit, or reverts them in the cache and returns
+// ErrRateLimited if WithRateLimitError is used.
+//
+// d.mu stays held while waiting so the writes are done in order.
+func (d *Dev) rateLimit(ctx context.Context) error {
+	wait, early := d.rateLimited()
+	if early == 0 {
+		return nil
+	}
+	if d.rateLimitErr {
+		d.port.SetWord(d.port.Word()&^early | d.written&early)
+		return fmt.Errorf("%w (0x%04x)", ErrRateLimited, early)
+	}
+	return d.waitRateLimit(ctx, wait)
+}
+
+// rateLimited returns the pins about to change sooner than allowed by
+// WithPinRateLimit and how long to wait for all of them.
+func (d *Dev) rateLimited() (time.Duration, uint16) {
+	var wait time.Duration
+	var early uint16
+	now := d.clock.Now()
+	changed := d.port.Word() ^ d.written
+	for i, iv := range d.minInterval {
+		if iv == 0 || changed&(1<<uint(i)) == 0 || d.lastChange[i].IsZero() {
+			continue
+		}
+		if w := iv - now.Sub(d.lastChange[i]); w > 0 {
+			early |= 1 << uint(i)
+			if w > wait {
+				wait = w
+			}
+		}
+	}
+	return wait, early
+}
+
+// waitRateLimit waits for wait or until ctx is done.
+func (d *Dev) waitRateLimit(ctx context.Context, wait time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-d.clock.After(wait):
+		return nil
+	}
+}
+
+// wrote records the output state just written successfully.
+func (d *Dev) wrote() {
+	now := d.clock.Now()
+	if d.history != nil {
+		d.record(now, d.written)
+	}
+	changed := d.port.Word() ^ d.written
+	for i, iv := range d.minInterval {
+		if iv != 0 && changed&(1<<uint(i)) != 0 {
+			d.lastChange[i] = now
+		}
+	}
+	d.written = d.port.Word()
+}
+
+// The encoding of MarshalBinary is a version byte followed by the fields of
+// the version, little endian. Bump the version when adding fields.
+const (
+	stateVersion = 1
+	stateSize    = 7
+)
+
+var _ Expander = &Dev{}
+var _ conn.Resource = &Dev{}
 var _ devices.Device = &Dev{}
+var _ gpio.Group = &Dev{}
+var _ encoding.BinaryMarshaler = &Dev{}
+var _ encoding.BinaryUnmarshaler = &Dev{}
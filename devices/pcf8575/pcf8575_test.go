@@ -0,0 +1,4035 @@
+// Copyright 2017 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package pcf8575
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"periph.io/x/periph/conn/conntest"
+	"periph.io/x/periph/conn/gpio"
+	"periph.io/x/periph/conn/gpio/gpioreg"
+	"periph.io/x/periph/conn/gpio/gpiotest"
+	"periph.io/x/periph/conn/i2c"
+	"periph.io/x/periph/conn/i2c/i2creg"
+	"periph.io/x/periph/conn/i2c/i2ctest"
+	"periph.io/x/periph/devices/pcf8574"
+)
+
+func Example() {
+	// On hardware, call host.Init and use the bus returned by i2creg.Open.
+	bus := &i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xfe, 0xff}},
+			{Addr: 0x20, R: []byte{0xfe, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	defer bus.Close()
+	d, err := New(bus, 0x20)
+	if err != nil {
+		log.Fatalf("failed to initialize pcf8575: %v", err)
+	}
+	defer d.Halt()
+	if err := d.WriteOutput(P00, false); err != nil {
+		log.Fatal(err)
+	}
+	l, err := d.ReadInput(P10)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("P10: %t\n", l)
+	// Output: P10: true
+}
+
+func ExampleDev_ReadInput() {
+	// Playback replaces a real bus, e.g. the one returned by i2creg.Open.
+	bus := &i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xfe, 0xff}},
+			{Addr: 0x20, R: []byte{0xfe, 0xfe}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(bus, 0x20)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer d.Halt()
+	if _, err := d.Toggle(0); err != nil {
+		log.Fatal(err)
+	}
+	l, err := d.ReadInput(8)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%s P10: %t\n", d, l)
+	// Output: PCF8575{0x20, out=0xFFFE} P10: false
+}
+
+func ExampleDev_Pin() {
+	bus := &i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xfd}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(bus, 0x20)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer d.Halt()
+	// The pins are also registered in gpioreg.
+	p := gpioreg.ByName("PCF8575_0x20_P11")
+	if err := p.Out(gpio.Low); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%s: %s\n", p, d.Pin(9).Function())
+	// Output: PCF8575_0x20_P11: Out/Low
+}
+
+var _ Expander = &pcf8574.Dev{}
+
+func TestPin(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xfd}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, R: []byte{0xff, 0xfd}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Pins()) != PinCount {
+		t.Fatal(d.Pins())
+	}
+	if P11 != 9 || P17 != PinCount-1 {
+		t.Fatal(P11, P17)
+	}
+	if d.Pin(16) != gpio.INVALID || d.Pin(-1) != gpio.INVALID {
+		t.Fatal("expected INVALID")
+	}
+	p := d.Pin(9)
+	if s := p.Name(); s != "PCF8575_0x20_P11" {
+		t.Fatal(s)
+	}
+	if n := p.Number(); n != 1521 {
+		t.Fatal(n)
+	}
+	if err := p.Out(gpio.Low); err != nil {
+		t.Fatal(err)
+	}
+	if f := p.Function(); f != "Out/Low" {
+		t.Fatal(f)
+	}
+	if err := p.In(gpio.PullDown, gpio.NoEdge); err == nil {
+		t.Fatal("pull-down is not supported")
+	}
+	if err := p.In(gpio.PullUp, gpio.BothEdges); err == nil {
+		t.Fatal("edge detection requires INT")
+	}
+	if err := p.In(gpio.PullUp, gpio.NoEdge); err != nil {
+		t.Fatal(err)
+	}
+	if f := p.Function(); f != "In/High" {
+		t.Fatal(f)
+	}
+	if l := p.Read(); l != gpio.Low {
+		t.Fatal(l)
+	}
+	if p.Pull() != gpio.PullUp || p.(gpio.PinDefaultPull).DefaultPull() != gpio.PullUp {
+		t.Fatal("expected PullUp")
+	}
+	if sink, source := p.(*Pin).Drive(); sink != SinkCurrent || source != SourceCurrent || d.CanSourceCurrent() {
+		t.Fatal(sink, source)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteOutput_ReadInput(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			// New sets all the outputs high.
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			// P03 low; the first byte is P00 to P07.
+			{Addr: 0x20, W: []byte{0xf7, 0xff}},
+			// P14 low; the second byte is P10 to P17.
+			{Addr: 0x20, W: []byte{0xf7, 0xef}},
+			{Addr: 0x20, R: []byte{0xe7, 0xef}},
+			{Addr: 0x20, R: []byte{0xe7, 0xef}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteOutput(3, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteOutput(12, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteOutput(-1, false); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if s := d.String(); s != "PCF8575{0x20, out=0xEFF7}" {
+		t.Fatal(s)
+	}
+	if c, ok := d.Conn().(*i2c.Dev); !ok || c.Addr != 0x20 {
+		t.Fatal(d.Conn())
+	}
+	if l, err := d.ReadOutput(12); l || err != nil {
+		t.Fatal(l, err)
+	}
+	if l, err := d.ReadInput(4); l || err != nil {
+		t.Fatal(l, err)
+	}
+	if l, err := d.ReadInput(8); !l || err != nil {
+		t.Fatal(l, err)
+	}
+	if _, err := d.ReadInput(-1); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNew_addr(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x40, W: []byte{0xff, 0xff}},
+			{Addr: 0x40, W: []byte{0xff, 0xff}},
+		},
+	}
+	for _, a := range []uint16{0x1f, 0x28, 0x40} {
+		if _, err := New(&bus, a); err == nil {
+			t.Fatalf("0x%x", a)
+		}
+	}
+	if _, err := New(&bus, 0x80, WithAnyAddress()); err == nil {
+		t.Fatal("10 bits address")
+	}
+	d, err := New(&bus, 0x40, WithAnyAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNew_register(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := gpioreg.ByName("PCF8575_0x20_P17"); p != d.Pin(15) {
+		t.Fatal(p)
+	}
+	if g := gpioreg.GroupByName("PCF8575_0x20"); g != d {
+		t.Fatal(g)
+	}
+	if _, err := New(&bus, 0x20); err == nil {
+		t.Fatal("pins are already registered")
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if p := gpioreg.ByName("PCF8575_0x20_P17"); p != nil {
+		t.Fatal(p)
+	}
+	if g := gpioreg.GroupByName("PCF8575_0x20"); g != nil {
+		t.Fatal(g)
+	}
+	d, err = New(&bus, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteAll(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0x0a, 0x81}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteAll(0x810a); err != nil {
+		t.Fatal(err)
+	}
+	for i, expected := range []bool{false, true, false, true, false, false, false, false, true, false, false, false, false, false, false, true} {
+		if l, err := d.ReadOutput(i); l != expected || err != nil {
+			t.Fatal(i, l, err)
+		}
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteMask(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0x00, 0x00}},
+			{Addr: 0x20, W: []byte{0x05, 0x80}},
+			{Addr: 0x20, W: []byte{0x05, 0x80}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20, WithInitialState(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// P00, P02 and P17 high; P01 stays low.
+	if err := d.WriteMask(0x8007, 0xffff&^2); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteMask(0, 0xffff); err != nil {
+		t.Fatal(err)
+	}
+	for i, exp := range map[int]bool{0: true, 1: false, 2: true, 3: false, 15: true} {
+		if l, err := d.ReadOutput(i); l != exp || err != nil {
+			t.Fatal(i, l, err)
+		}
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetPins_ClearPins(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0x00, 0x00}},
+			{Addr: 0x20, W: []byte{0x03, 0x80}},
+			{Addr: 0x20, W: []byte{0x02, 0x80}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20, WithInitialState(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetPins(0x8003); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ClearPins(0x0101); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestToggleMask(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0x00, 0x00}},
+			{Addr: 0x20, W: []byte{0x05, 0x80}},
+			{Addr: 0x20, W: []byte{0x00, 0x00}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20, WithInitialState(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := d.ToggleMask(0x8005); v != 0x8005 || err != nil {
+		t.Fatal(v, err)
+	}
+	d.SetInvertedMask(0x0001)
+	if v, err := d.ToggleMask(0x8005); v != 0x0001 || err != nil {
+		t.Fatal(v, err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestToggleIndices(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0x00, 0x00}},
+			{Addr: 0x20, W: []byte{0x05, 0x80}},
+			{Addr: 0x20, W: []byte{0x07, 0x80}},
+			{Addr: 0x20, W: []byte{0x06, 0x80}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20, WithInitialState(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.ToggleIndices(0, 16); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if v, err := d.ToggleIndices(P00, P02, P17, P02); v != 0x8005 || err != nil {
+		t.Fatal(v, err)
+	}
+	if err := d.SetDirection(P01, false); err != nil {
+		t.Fatal(err)
+	}
+	// P01 is an input and stays high.
+	if v, err := d.ToggleIndices(P00, P01); v != 0x8006 || err != nil {
+		t.Fatalf("0x%04x %v", v, err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDefineGroup(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xfe, 0xfb}},
+			{Addr: 0x20, R: []byte{0xfe, 0xfb}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.DefineGroup("", []int{0}); err == nil {
+		t.Fatal("empty name")
+	}
+	if err := d.DefineGroup("bus", nil); err == nil {
+		t.Fatal("no pins")
+	}
+	if err := d.DefineGroup("bus", []int{0, 16}); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if err := d.DefineGroup("bus", []int{0, 0}); err == nil {
+		t.Fatal("duplicate pin")
+	}
+	if err := d.DefineGroup("bus", []int{P00, P12, P01}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteGroup("bus", 8); !errors.Is(err, ErrValueOverflow) {
+		t.Fatal(err)
+	}
+	if err := d.WriteGroup("other", 0); err == nil {
+		t.Fatal("unknown group")
+	}
+	if _, err := d.ReadGroup("other"); err == nil {
+		t.Fatal("unknown group")
+	}
+	if err := d.WriteGroup("bus", 4); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := d.ReadGroup("bus"); v != 4 || err != nil {
+		t.Fatal(v, err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadField_WriteField(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0x00, 0x00}},
+			{Addr: 0x20, W: []byte{0x50, 0x00}},
+			{Addr: 0x20, W: []byte{0x50, 0xff}},
+			{Addr: 0x20, R: []byte{0x50, 0xa5}},
+			{Addr: 0x20, R: []byte{0x50, 0xa5}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20, WithInitialState(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteField(4, 3, 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteField(8, 8, 0xff); err != nil {
+		t.Fatal(err)
+	}
+	err = d.WriteField(0, 3, 8)
+	if !errors.Is(err, ErrValueOverflow) {
+		t.Fatal(err)
+	}
+	if s := err.Error(); s != "PCF8575.WriteField: value doesn't fit in the field (8 in 3 bits)" {
+		t.Fatal(s)
+	}
+	if err := d.WriteField(14, 3, 0); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if err := d.WriteField(0, 0, 0); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if _, err := d.ReadField(-1, 2); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if v, err := d.ReadField(12, 4); v != 0xa || err != nil {
+		t.Fatal(v, err)
+	}
+	if v, err := d.ReadField(0, 16); v != 0xa550 || err != nil {
+		t.Fatal(v, err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0x01, 0x00}},
+			{Addr: 0x20, W: []byte{0x02, 0x80}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20, WithInitialState(0x0001))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.SetInvertedMask(0x8000)
+	v, err := d.Update(func(state uint16) uint16 {
+		if state != 0x8001 {
+			t.Fatalf("0x%04x", state)
+		}
+		return state << 1
+	})
+	if v != 0x0002 || err != nil {
+		t.Fatal(v, err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestToggleAll(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0x0f, 0x00}},
+			{Addr: 0x20, W: []byte{0xf0, 0xff}},
+			{Addr: 0x20, W: []byte{0xf0, 0xff}},
+			{Addr: 0x20, W: []byte{0x1f, 0x00}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20, WithInitialState(0x000f))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := d.ToggleAll(); v != 0xfff0 || err != nil {
+		t.Fatal(v, err)
+	}
+	d.SetInvertedMask(0x8000)
+	if err := d.SetDirection(4, false); err != nil {
+		t.Fatal(err)
+	}
+	// P04 is an input and stays high.
+	if v, err := d.ToggleAll(); v != 0x801f || err != nil {
+		t.Fatalf("0x%04x %v", v, err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetState_SetState(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0x34, 0x12}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0x34, 0x12}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20, WithInitialState(0x1234))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.SetInvertedMask(0xffff)
+	s := d.GetState()
+	if s != 0x1234 {
+		t.Fatalf("0x%04x", s)
+	}
+	if err := d.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetState(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteIfChanged(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xfe, 0xff}},
+			// Reset.
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xfe, 0xff}},
+			{Addr: 0x20, W: []byte{0x34, 0x12}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+		DontPanic: true,
+	}
+	d, err := New(&bus, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, err := d.WriteIfChanged(0, true); c || err != nil {
+		t.Fatal(c, err)
+	}
+	if c, err := d.WriteIfChanged(0, false); !c || err != nil {
+		t.Fatal(c, err)
+	}
+	if c, err := d.WriteIfChanged(0, false); c || err != nil {
+		t.Fatal(c, err)
+	}
+	if err := d.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := d.WriteIfChanged(0, false); !c || err != nil {
+		t.Fatal(c, err)
+	}
+	if _, err := d.WriteIfChanged(16, false); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	// The playback expects 0x1234, the write fails.
+	if c, err := d.WriteAllIfChanged(0x5678); !c || err == nil {
+		t.Fatal(c, err)
+	}
+	// The write is retried since the previous one failed.
+	if c, err := d.WriteAllIfChanged(0x5678); !c || err == nil {
+		t.Fatal(c, err)
+	}
+	if c, err := d.WriteAllIfChanged(0x1234); !c || err != nil {
+		t.Fatal(c, err)
+	}
+	if c, err := d.WriteAllIfChanged(0x1234); c || err != nil {
+		t.Fatal(c, err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadAll(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, R: []byte{0x0a, 0x81}},
+			{Addr: 0x20, R: []byte{0x0a, 0x81}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := d.ReadAll(); v != 0x810a || err != nil {
+		t.Fatal(v, err)
+	}
+	if v, err := d.ReadInputMask(0x00ff); v != 0x000a || err != nil {
+		t.Fatal(v, err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteReadAll(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xf3, 0x00}, R: []byte{0xf3, 0x00}},
+			{Addr: 0x20, R: []byte{0xfe, 0xff}},
+			{Addr: 0x20, W: []byte{0xfe, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+		DontPanic: true,
+	}
+	d, err := New(&bus, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.SetInvertedMask(0x0001)
+	if err := d.SetDirection(1, false); err != nil {
+		t.Fatal(err)
+	}
+	// The input pin stays latched high.
+	if v, err := d.WriteReadAll(0x00f0); v != 0x00f2 || err != nil {
+		t.Fatal(v, err)
+	}
+	// Staged writes only do the read.
+	d.Begin()
+	if v, err := d.WriteReadAll(0xffff); v != 0xffff || err != nil {
+		t.Fatal(v, err)
+	}
+	if err := d.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.WriteReadAll(0); err == nil {
+		t.Fatal("expected failure")
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithPortInverted(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			// The device's power-on state.
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xfe, 0xff}},
+			{Addr: 0x20, R: []byte{0xfe, 0xff}},
+			{Addr: 0x20, R: []byte{0xfc, 0x7f}},
+			{Addr: 0x20, R: []byte{0xfc, 0x7f}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, R: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xfd, 0xff}},
+			{Addr: 0x20, R: []byte{0xfd, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xf7, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20, WithPortInverted())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteOutput(0, true); err != nil {
+		t.Fatal(err)
+	}
+	// The pin is latched low on the bus, it can't be read.
+	if _, err := d.ReadInput(0); !errors.Is(err, ErrLatchedLow) {
+		t.Fatal(err)
+	}
+	if l, err := d.ReadInput(1); !l || err != nil {
+		t.Fatal(l, err)
+	}
+	if f := d.Pin(0).Function(); f != "Out/Low" {
+		t.Fatal(f)
+	}
+	if f := d.Pin(1).Function(); f != "In/High" {
+		t.Fatal(f)
+	}
+	if v, err := d.ReadAll(); v != 0x8003 || err != nil {
+		t.Fatal(v, err)
+	}
+	// In latches the pin high on the bus.
+	if l, err := d.In(0); l || err != nil {
+		t.Fatal(l, err)
+	}
+	if f := d.Pin(0).Function(); f != "In/High" {
+		t.Fatal(f)
+	}
+	// SetInverted is applied on top.
+	if err := d.SetInverted(1, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteOutput(1, false); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := d.ReadRaw(); b != [2]byte{0xfd, 0xff} || err != nil {
+		t.Fatal(b, err)
+	}
+	if err := d.Pin(1).In(gpio.PullUp, gpio.NoEdge); err != nil {
+		t.Fatal(err)
+	}
+	if f := d.Pin(1).Function(); f != "In/High" {
+		t.Fatal(f)
+	}
+	if err := d.WriteOutput(3, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSenseOutput(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xfe, 0xff}},
+			{Addr: 0x20, R: []byte{0xfc, 0xff}},
+			{Addr: 0x20, R: []byte{0xfc, 0xff}},
+			{Addr: 0x20, W: []byte{0xfe, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteOutput(0, false); err != nil {
+		t.Fatal(err)
+	}
+	// No ErrLatchedLow, unlike ReadInput.
+	if l, err := d.SenseOutput(0); l || err != nil {
+		t.Fatal(l, err)
+	}
+	// Latched high but pulled low externally.
+	if l, err := d.SenseOutput(1); l || err != nil {
+		t.Fatal(l, err)
+	}
+	if l, err := d.ReadOutput(1); !l || err != nil {
+		t.Fatal(l, err)
+	}
+	if _, err := d.SenseOutput(16); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if err := d.SetDirection(2, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.SenseOutput(2); !errors.Is(err, ErrDirection) {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBegin_Flush(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, R: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xfe, 0x7f}},
+			{Addr: 0x20, W: []byte{0xfc, 0x7f}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Begin()
+	if err := d.WriteOutput(0, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteOutput(15, false); err != nil {
+		t.Fatal(err)
+	}
+	// Reads are not staged.
+	if _, err := d.ReadAll(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	// Writes are immediate again.
+	if err := d.WriteOutput(1, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFlush_fail(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+		DontPanic: true,
+	}
+	d, err := New(&bus, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Begin()
+	if err := d.WriteOutput(0, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Flush(); err == nil {
+		t.Fatal("playback is empty")
+	}
+	bus.Ops = append(bus.Ops, i2ctest.IO{Addr: 0x20, W: []byte{0xfe, 0xff}}, i2ctest.IO{Addr: 0x20, W: []byte{0xff, 0xff}})
+	if err := d.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestToggle(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xef}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l, err := d.Toggle(12); l || err != nil {
+		t.Fatal(l, err)
+	}
+	if l, err := d.Toggle(12); !l || err != nil {
+		t.Fatal(l, err)
+	}
+	if _, err := d.Toggle(16); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPinRange(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteOutput(16, true); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if _, err := d.ReadOutput(-1); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if _, err := d.ReadOutputLatch(16); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	_, err = d.ReadInput(16)
+	if !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if s := err.Error(); s != "PCF8575.ReadInput: pin index out of range (16)" {
+		t.Fatal(s)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTx_fail(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+		DontPanic: true,
+	}
+	d, err := New(&bus, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Halt()
+	if err := d.WriteOutput(0, false); err == nil || !conntest.IsErr(errors.Unwrap(err)) {
+		t.Fatal(err)
+	}
+	if _, err := d.ReadInput(0); err == nil || !conntest.IsErr(errors.Unwrap(err)) {
+		t.Fatal(err)
+	}
+}
+
+func TestNew_opts(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0x34, 0x12}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0x00, 0x00}},
+		},
+	}
+	d, err := New(&bus, 0x20, WithInitialState(0x1234))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	d, err = New(&bus, 0x20, WithInitialState(0), WithNoInitialWrite(), WithSafeState(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l, err := d.ReadOutput(0); l || err != nil {
+		t.Fatal(l, err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPin_WaitForEdge(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			// In().
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, R: []byte{0xff, 0xff}},
+			// Another pin changed.
+			{Addr: 0x20, R: []byte{0xfe, 0xff}},
+			// P03 went low.
+			{Addr: 0x20, R: []byte{0xf6, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	intPin := &gpiotest.Pin{N: "INT", EdgesChan: make(chan gpio.Level, 2)}
+	d, err := New(&bus, 0x20, WithInterruptPin(intPin))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := d.Pin(3)
+	if p.WaitForEdge(0) {
+		t.Fatal("edge detection is not enabled")
+	}
+	if err := p.In(gpio.PullUp, gpio.FallingEdge); err != nil {
+		t.Fatal(err)
+	}
+	if p.WaitForEdge(0) {
+		t.Fatal("INT didn't fire")
+	}
+	intPin.EdgesChan <- gpio.Low
+	intPin.EdgesChan <- gpio.Low
+	if !p.WaitForEdge(time.Second) {
+		t.Fatal("expected falling edge")
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWaitForEdge(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, R: []byte{0xff, 0xff}},
+			{Addr: 0x20, R: []byte{0xfe, 0x7f}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	intPin := &gpiotest.Pin{N: "INT", EdgesChan: make(chan gpio.Level, 1)}
+	d, err := New(&bus, 0x20, WithInterruptPin(intPin))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i, l, err := d.WaitForEdge(0); i != -1 || l || err != nil {
+		t.Fatal(i, l, err)
+	}
+	intPin.EdgesChan <- gpio.Low
+	if i, l, err := d.WaitForEdge(time.Second); i != 0 || l || err != nil {
+		t.Fatal(i, l, err)
+	}
+	// The second change is reported without waiting for INT.
+	if i, l, err := d.WaitForEdge(0); i != 15 || l || err != nil {
+		t.Fatal(i, l, err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWaitForEdge_noINT(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Halt()
+	if _, _, err := d.WaitForEdge(0); err == nil {
+		t.Fatal("INT pin is required")
+	}
+}
+
+func TestHalt(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+		DontPanic: true,
+	}
+	d, err := New(&bus, 0x20, WithSafeState(0x000f))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Staged writes are discarded.
+	d.Begin()
+	if err := d.WriteAll(0x1234); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err == nil {
+		t.Fatal("expected write failure")
+	}
+	// The pins are unregistered even on failure.
+	if p := gpioreg.ByName("PCF8575_0x20_P00"); p != nil {
+		t.Fatal(p)
+	}
+	bus.Ops = append(bus.Ops, i2ctest.IO{Addr: 0x20, W: []byte{0x0f, 0x00}})
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReset(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0x00, 0x00}},
+		},
+		DontPanic: true,
+	}
+	d, err := New(&bus, 0x20, WithInitialState(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Reset(); err == nil {
+		t.Fatal("expected write failure")
+	}
+	if l, err := d.ReadOutput(0); l || err != nil {
+		t.Fatal("cached state must be unchanged")
+	}
+	bus.Ops = append(bus.Ops, i2ctest.IO{Addr: 0x20, W: []byte{0xff, 0xff}}, i2ctest.IO{Addr: 0x20, W: []byte{0xff, 0xff}})
+	if err := d.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if l, err := d.ReadOutput(0); !l || err != nil {
+		t.Fatal(l, err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPinByName(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetNames(map[int]string{P11: "RELAY"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []string{"RELAY", "P11", "PCF8575_0x20_P00"} {
+		if _, err := d.PinByName(n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p, _ := d.PinByName("RELAY"); p != d.Pin(P11) {
+		t.Fatal(p)
+	}
+	if p, _ := d.PinByName("P17"); p != d.Pin(P17) {
+		t.Fatal(p)
+	}
+	// The default name is replaced by the alias.
+	if _, err := d.PinByName("PCF8575_0x20_P11"); err == nil {
+		t.Fatal("expected unknown pin")
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetNames(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetNames(map[int]string{11: "PUMP_ENABLE"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := d.Pin(11).Name(); n != "PUMP_ENABLE" {
+		t.Fatal(n)
+	}
+	if p := gpioreg.ByName("PUMP_ENABLE"); p != d.Pin(11) {
+		t.Fatal(p)
+	}
+	if p := gpioreg.ByName("PCF8575_0x20_P13"); p != nil {
+		t.Fatal(p)
+	}
+	// A conflicting name restores the previous names.
+	if err := d.SetNames(map[int]string{0: "PUMP_ENABLE"}); err == nil {
+		t.Fatal("expected registration failure")
+	}
+	if n := d.Pin(0).Name(); n != "PCF8575_0x20_P00" {
+		t.Fatal(n)
+	}
+	if p := gpioreg.ByName("PUMP_ENABLE"); p != d.Pin(11) {
+		t.Fatal(p)
+	}
+	if err := d.SetNames(map[int]string{16: "FOO"}); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if err := d.SetNames(map[int]string{11: ""}); err != nil {
+		t.Fatal(err)
+	}
+	if n := d.Pin(11).Name(); n != "PCF8575_0x20_P13" {
+		t.Fatal(n)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScan(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("NACK detection is only implemented on linux")
+	}
+	bus := scanBus{acks: map[uint16]bool{0x21: true, 0x26: true}}
+	if a, err := Scan(&bus); err != nil || len(a) != 2 || a[0] != 0x21 || a[1] != 0x26 {
+		t.Fatal(a, err)
+	}
+	// A bus failure aborts the scan.
+	bus.err = errors.New("bus failure")
+	bus.seen = false
+	if a, err := Scan(&bus); !errors.Is(err, bus.err) || len(a) != 1 || a[0] != 0x21 {
+		t.Fatal(a, err)
+	}
+	if a, err := Scan(&scanBus{}); a != nil || err != nil {
+		t.Fatal(a, err)
+	}
+}
+
+func TestReadInputDebounced(t *testing.T) {
+	bus := bounceBus{v: 0xff}
+	d, err := New(&bus, 0x20, WithDebounceSampling(time.Microsecond, 5*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.ReadInputDebounced(16, time.Millisecond); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if l, err := d.ReadInputDebounced(0, time.Millisecond); !l || err != nil {
+		t.Fatal(l, err)
+	}
+	bus.Lock()
+	bus.bounce = true
+	bus.Unlock()
+	if _, err := d.ReadInputDebounced(0, time.Millisecond); !errors.Is(err, ErrUnstable) {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(&bus, 0x21, WithDebounceSampling(0, time.Second)); err == nil {
+		t.Fatal("invalid interval")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	data := []struct {
+		prev, next uint16
+		want       []Change
+	}{
+		{0xffff, 0xffff, nil},
+		{0xffff, 0xfffe, []Change{{0, false}}},
+		{0x0000, 0x8000, []Change{{15, true}}},
+		{0x00ff, 0xff00, []Change{{0, false}, {1, false}, {2, false}, {3, false}, {4, false}, {5, false}, {6, false}, {7, false}, {8, true}, {9, true}, {10, true}, {11, true}, {12, true}, {13, true}, {14, true}, {15, true}}},
+		{0x0101, 0x0110, []Change{{0, false}, {4, true}}},
+	}
+	for i, line := range data {
+		got := Diff(line.prev, line.next)
+		if len(got) != len(line.want) {
+			t.Fatalf("#%d: %v", i, got)
+		}
+		for j := range got {
+			if got[j] != line.want[j] {
+				t.Fatalf("#%d: %v", i, got)
+			}
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	bus := bounceBus{v: 0xff}
+	d, err := New(&bus, 0x20, WithPollInterval(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := d.Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus.Lock()
+	bus.v = 0xfa
+	bus.Unlock()
+	for _, i := range []int{0, 2} {
+		if e := <-ch; e.Index != i || e.Level || e.Err != nil || e.Time.IsZero() {
+			t.Fatal(e)
+		}
+	}
+	cancel()
+	for range ch {
+	}
+
+	ch, err = d.Watch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus.Lock()
+	bus.err = errors.New("bus error")
+	bus.Unlock()
+	if e := <-ch; e.Index != -1 || e.Err == nil {
+		t.Fatal(e)
+	}
+	if e, ok := <-ch; ok {
+		t.Fatal(e)
+	}
+	if _, err := d.Watch(context.Background()); err == nil {
+		t.Fatal("bus error")
+	}
+	bus.Lock()
+	bus.err = nil
+	bus.Unlock()
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatchPin(t *testing.T) {
+	bus := bounceBus{v: 0xff}
+	d, err := New(&bus, 0x20, WithPollInterval(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WatchPin(16, gpio.BothEdges); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	for i, e := range []gpio.Edge{gpio.FallingEdge, gpio.RisingEdge, gpio.NoEdge} {
+		if err := d.WatchPin(i, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := d.Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus.Lock()
+	bus.v = 0xf0
+	bus.Unlock()
+	for _, i := range []int{0, 3} {
+		if e := <-ch; e.Index != i || e.Level {
+			t.Fatal(e)
+		}
+	}
+	bus.Lock()
+	bus.v = 0xff
+	bus.Unlock()
+	for _, i := range []int{1, 3} {
+		if e := <-ch; e.Index != i || !e.Level {
+			t.Fatal(e)
+		}
+	}
+	cancel()
+	for range ch {
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOnChange(t *testing.T) {
+	bus := bounceBus{v: 0xff}
+	d, err := New(&bus, 0x20, WithPollInterval(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.OnChange(16, func(bool) {}); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	got := make(chan int, 2)
+	if err := d.OnChange(0, func(l bool) {
+		// The callback can use the device.
+		if o, err := d.ReadOutput(0); !o || err != nil || l {
+			t.Error(o, err, l)
+		}
+		got <- 0
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.OnChange(1, func(l bool) { got <- 1 }); err != nil {
+		t.Fatal(err)
+	}
+	bus.Lock()
+	bus.v = 0xfc
+	bus.Unlock()
+	if i := <-got; i != 0 {
+		t.Fatal(i)
+	}
+	if i := <-got; i != 1 {
+		t.Fatal(i)
+	}
+	d.StopWatching()
+	d.StopWatching()
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOnChange_fail(t *testing.T) {
+	bus := bounceBus{v: 0xff}
+	d, err := New(&bus, 0x20, WithPollInterval(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(chan bool, 2)
+	fn := func(l bool) { got <- l }
+	bus.fails = 1
+	if err := d.OnChange(0, fn); !errors.Is(err, syscall.ENXIO) {
+		t.Fatal(err)
+	}
+	// The retry registers fn only once.
+	if err := d.OnChange(0, fn); err != nil {
+		t.Fatal(err)
+	}
+	bus.Lock()
+	bus.v = 0xfe
+	bus.Unlock()
+	if l := <-got; l {
+		t.Fatal(l)
+	}
+	d.StopWatching()
+	if len(got) != 0 {
+		t.Fatal("fn called twice")
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatch_INT(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, R: []byte{0xff, 0xff}},
+			{Addr: 0x20, R: []byte{0xff, 0x7f}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	intPin := &gpiotest.Pin{N: "INT", EdgesChan: make(chan gpio.Level, 1)}
+	d, err := New(&bus, 0x20, WithInterruptPin(intPin), WithPollInterval(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := d.Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intPin.EdgesChan <- gpio.Low
+	if e := <-ch; e.Index != 15 || e.Level || e.Err != nil {
+		t.Fatal(e)
+	}
+	cancel()
+	for range ch {
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyWrites(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, R: []byte{0xff, 0xfe}},
+			{Addr: 0x20, W: []byte{0xf7, 0xff}},
+			{Addr: 0x20, R: []byte{0xf7, 0x00}},
+			{Addr: 0x20, W: []byte{0xf3, 0xff}},
+			{Addr: 0x20, R: []byte{0xf7, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, R: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20, WithVerifyWrites())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteOutput(3, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteOutput(2, false); !errors.Is(err, ErrVerify) {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	bus := bounceBus{v: 0xfe, fails: 2}
+	d, err := New(&bus, 0x20, WithRetry(3, time.Microsecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus.fails = 2
+	if l, err := d.ReadInput(0); l || err != nil {
+		t.Fatal(l, err)
+	}
+	bus.fails = 3
+	err = d.WriteOutput(0, false)
+	if !errors.Is(err, syscall.ENXIO) {
+		t.Fatal(err)
+	}
+	if s := err.Error(); s != "pcf8575: write output: 3 attempts: "+syscall.ENXIO.Error() {
+		t.Fatal(s)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(&bus, 0x21, WithRetry(0, 0)); err == nil {
+		t.Fatal("invalid attempts")
+	}
+}
+
+func TestWithHistory(t *testing.T) {
+	bus := bounceBus{v: 0xff}
+	d, err := New(&bus, 0x20, WithHistory(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteOutput(0, false); err != nil {
+		t.Fatal(err)
+	}
+	d.SetInvertedMask(0x0002)
+	if err := d.WriteMask(0x0003, 0x0003); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteOutput(2, false); err != nil {
+		t.Fatal(err)
+	}
+	// The oldest change was overwritten.
+	var got []string
+	for _, c := range d.History() {
+		if c.Time.IsZero() {
+			t.Fatal("missing time")
+		}
+		got = append(got, fmt.Sprintf("%d:%t>%t", c.Index, c.Old, c.New))
+	}
+	if s := strings.Join(got, " "); s != "0:false>true 1:false>true 2:true>false" {
+		t.Fatal(s)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	d, err = New(&bus, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := d.History(); h != nil {
+		t.Fatal(h)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(&bus, 0x21, WithHistory(0)); err == nil {
+		t.Fatal("invalid size")
+	}
+}
+
+func TestWithOutOfRangePolicy(t *testing.T) {
+	bus := bounceBus{v: 0xff}
+	d, err := New(&bus, 0x20, WithOutOfRangePolicy(OutOfRangeError))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteOutput(16, true); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err = New(&bus, 0x20, WithOutOfRangePolicy(OutOfRangeIgnore))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := len(bus.writes)
+	if err := d.WriteOutput(16, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteOutputContext(context.Background(), -1, false); err != nil {
+		t.Fatal(err)
+	}
+	if l, err := d.ReadOutput(16); l || err != nil {
+		t.Fatal(l, err)
+	}
+	if l, err := d.ReadInput(16); l || err != nil {
+		t.Fatal(l, err)
+	}
+	if l, err := d.ReadInputContext(context.Background(), 16); l || err != nil {
+		t.Fatal(l, err)
+	}
+	if len(bus.writes) != n || bus.reads != 0 {
+		t.Fatal("no I/O expected")
+	}
+	// The other methods are not affected.
+	if _, err := d.Toggle(16); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if _, err := d.WaitForPinEdge(16, gpio.BothEdges, time.Second); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err = New(&bus, 0x20, WithOutOfRangePolicy(OutOfRangePanic))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []func(){
+		func() { d.WriteOutput(16, true) },
+		func() { d.ReadOutput(16) },
+		func() { d.ReadInput(-1) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("expected panic")
+				}
+			}()
+			f()
+		}()
+	}
+	if _, err := d.WaitForPinEdge(-1, gpio.BothEdges, time.Second); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	// The Dev is still usable after the panic.
+	if err := d.WriteOutput(0, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New(&bus, 0x21, WithOutOfRangePolicy(3)); err == nil {
+		t.Fatal("invalid policy")
+	}
+}
+
+func TestWithPinRateLimit(t *testing.T) {
+	bus := bounceBus{v: 0xff}
+	d, err := New(&bus, 0x20, WithPinRateLimit(0, 20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteOutput(0, false); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := d.WriteOutput(0, true); err != nil {
+		t.Fatal(err)
+	}
+	if e := time.Since(start); e < 15*time.Millisecond {
+		t.Fatal("write not rate limited", e)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err = New(&bus, 0x20, WithPinRateLimit(0, time.Hour), WithRateLimitError())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteOutput(0, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteAll(0xffff); !errors.Is(err, ErrRateLimited) {
+		t.Fatal(err)
+	}
+	// The rate limited pin keeps its level, the others are written next time.
+	if v := d.GetState(); v != 0xfffe {
+		t.Fatalf("0x%04x", v)
+	}
+	if err := d.WriteOutput(1, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if w := bus.writes[len(bus.writes)-1]; w[0] != 0xff || w[1] != 0xff {
+		t.Fatal(w)
+	}
+
+	if _, err := New(&bus, 0x21, WithPinRateLimit(16, time.Second)); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if _, err := New(&bus, 0x21, WithPinRateLimit(0, 0)); err == nil {
+		t.Fatal("invalid interval")
+	}
+}
+
+func TestWithPinRateLimit_locked(t *testing.T) {
+	bus := bounceBus{v: 0xff}
+	c := &gateClock{fakeClock: fakeClock{now: time.Unix(1, 0)}, waiting: make(chan time.Duration), release: make(chan time.Time)}
+	d, err := New(&bus, 0x20, WithSafeState(0), WithPinRateLimit(0, time.Second), WithClock(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteOutput(0, false); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- d.WriteOutput(0, true)
+	}()
+	if w := <-c.waiting; w != time.Second {
+		t.Fatal(w)
+	}
+	// The Dev stays locked while the write waits, Halt can't overtake it.
+	if d.mu.TryLock() {
+		d.mu.Unlock()
+		t.Fatal("the Dev is not locked while waiting")
+	}
+	halted := make(chan error)
+	go func() {
+		halted <- d.Halt()
+	}()
+	c.release <- time.Time{}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-halted; err != nil {
+		t.Fatal(err)
+	}
+	bus.Lock()
+	defer bus.Unlock()
+	exp := [][]byte{{0xff, 0xff}, {0xfe, 0xff}, {0xff, 0xff}, {0x00, 0x00}}
+	if !reflect.DeepEqual(bus.writes, exp) {
+		t.Fatal(bus.writes)
+	}
+}
+
+func TestNewWithContext(t *testing.T) {
+	bus := bounceBus{v: 0xff, fails: 1}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if _, err := NewWithContext(ctx, &bus, 0x20, WithRetry(3, time.Hour)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal(err)
+	}
+	d, err := NewWithContext(context.Background(), &bus, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bus.writes) != 1 {
+		t.Fatal(bus.writes)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWaitForPinEdge(t *testing.T) {
+	bus := bounceBus{v: 0xff}
+	d, err := New(&bus, 0x20, WithPollInterval(time.Microsecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.WaitForPinEdge(0, gpio.NoEdge, 0); err == nil {
+		t.Fatal("invalid edge")
+	}
+	if _, err := d.WaitForPinEdge(16, gpio.BothEdges, 0); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if ok, err := d.WaitForPinEdge(0, gpio.BothEdges, time.Millisecond); ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	// The pin toggles on each read.
+	bus.Lock()
+	bus.bounce = true
+	bus.Unlock()
+	if ok, err := d.WaitForPinEdge(0, gpio.RisingEdge, time.Second); !ok || err != nil {
+		t.Fatal(ok, err)
+	}
+	if l, err := d.ReadInput(0); l || err != nil {
+		t.Fatal(l, err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	ms := time.Millisecond
+	data := []struct {
+		b     Backoff
+		retry int
+		want  time.Duration
+	}{
+		{ConstantBackoff(ms), 1, ms},
+		{ConstantBackoff(ms), 5, ms},
+		{LinearBackoff(ms), 1, ms},
+		{LinearBackoff(ms), 3, 3 * ms},
+		{ExponentialBackoff{Initial: ms}, 1, ms},
+		{ExponentialBackoff{Initial: ms}, 4, 8 * ms},
+		{ExponentialBackoff{Initial: ms, Max: 5 * ms}, 4, 5 * ms},
+		{ExponentialBackoff{Initial: ms}, 100, maxDuration},
+		{ExponentialBackoff{}, 3, 0},
+	}
+	for i, line := range data {
+		if d := line.b.Delay(line.retry); d != line.want {
+			t.Fatalf("#%d: %v != %v", i, d, line.want)
+		}
+	}
+}
+
+func TestWithBackoff(t *testing.T) {
+	bus := bounceBus{v: 0xfe}
+	// WithBackoff takes precedence over WithRetry whatever the order.
+	d, err := New(&bus, 0x20, WithBackoff(ConstantBackoff(time.Hour)), WithRetry(3, time.Microsecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	bus.fails = 1
+	if _, err := d.ReadInputContext(ctx, 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(&bus, 0x21, WithBackoff(nil)); err == nil {
+		t.Fatal("invalid backoff")
+	}
+}
+
+func TestContext(t *testing.T) {
+	bus := bounceBus{v: 0xfe}
+	d, err := New(&bus, 0x20, WithRetry(3, time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	bus.fails = 1
+	if _, err := d.ReadInputContext(ctx, 0); !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+	if bus.fails != 1 {
+		t.Fatal("no transaction expected")
+	}
+	// The retry backoff is interrupted.
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if err := d.WriteOutputContext(ctx, 1, false); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal(err)
+	}
+	if _, err := d.ReadInputContext(context.Background(), 16); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if l, err := d.ReadInputContext(context.Background(), 0); l || err != nil {
+		t.Fatal(l, err)
+	}
+	if err := d.WriteOutputContext(context.Background(), 1, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithTracer(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xfe, 0xff}},
+			{Addr: 0x20, R: []byte{0xfe, 0x7f}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+		DontPanic: true,
+	}
+	var got []string
+	var d *Dev
+	tracer := func(op string, w, r []byte, err error) {
+		if d != nil {
+			// The lock is released.
+			_ = d.String()
+		}
+		got = append(got, fmt.Sprintf("%s %x %x %v", op, w, r, err != nil))
+	}
+	d, err := New(&bus, 0x20, WithTracer(tracer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteOutput(0, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.ReadAll(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteOutput(1, false); err == nil {
+		t.Fatal("expected failure")
+	}
+	exp := []string{"write ffff  false", "write feff  false", "read  fe7f false", "write fcff  true"}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatal(got)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStats(t *testing.T) {
+	bus := bounceBus{v: 0xfe}
+	d, err := New(&bus, 0x20, WithRetry(2, time.Microsecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus.fails = 1
+	if _, err := d.ReadInput(0); err != nil {
+		t.Fatal(err)
+	}
+	bus.fails = 2
+	if err := d.WriteOutput(1, false); err == nil {
+		t.Fatal("expected failure")
+	}
+	if s := d.Stats(); s != (Stats{Writes: 2, Reads: 1, Retries: 2, Errors: 1}) {
+		t.Fatalf("%+v", s)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSync(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xfe, 0xff}},
+			{Addr: 0x20, W: []byte{0xfe, 0xff}},
+			{Addr: 0x20, R: []byte{0xfe, 0x7f}},
+			{Addr: 0x20, W: []byte{0xfe, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+		DontPanic: true,
+	}
+	d, err := New(&bus, 0x20, WithInitialState(0xfffe))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := d.Sync(); v != 0x7ffe || err != nil {
+		t.Fatal(v, err)
+	}
+	// The read fails.
+	if _, err := d.Sync(); err == nil {
+		t.Fatal("expected failure")
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMarshalBinary(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xfe, 0xff}},
+			{Addr: 0x20, W: []byte{0xfe, 0xff}},
+			{Addr: 0x20, W: []byte{0x02, 0x00}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xfe, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20, WithInitialState(0xfffe))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.SetInvertedMask(0x8000)
+	if err := d.SetDirection(1, false); err != nil {
+		t.Fatal(err)
+	}
+	b, err := d.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := fmt.Sprintf("%x", b); s != "01feff00800200" {
+		t.Fatal(s)
+	}
+	if err := d.UnmarshalBinary(b[:3]); err == nil {
+		t.Fatal("short state")
+	}
+	if err := d.UnmarshalBinary([]byte{2}); err == nil {
+		t.Fatal("unknown version")
+	}
+	if err := d.SetState(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err = New(&bus, 0x20, WithNoInitialWrite())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if d.GetState() != 0xfffe {
+		t.Fatal("state not restored")
+	}
+	if err := d.WriteOutput(1, false); !errors.Is(err, ErrDirection) {
+		t.Fatal(err)
+	}
+	if l, err := d.ReadOutput(15); l || err != nil {
+		t.Fatal("inversion not restored")
+	}
+	if err := d.SetState(d.GetState()); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestState_JSON(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xfe, 0xff}},
+			{Addr: 0x20, W: []byte{0xfe, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20, WithInitialState(0xfffe))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.SetInvertedMask(0x8000)
+	if err := d.SetDirection(1, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetNames(map[int]string{0: "LED"}); err != nil {
+		t.Fatal(err)
+	}
+	st := d.State()
+	if st.Output != 0x7ffe || st.InputPins != 0x0002 || st.Inverted != 0x8000 || st.Names[0] != "LED" {
+		t.Fatalf("%+v", st)
+	}
+	b, err := json.Marshal(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got State
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, st) {
+		t.Fatalf("%+v != %+v", got, st)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The pins not listed keep their power-on state.
+	b = []byte(`{"version": 1, "pins": [{"index": 2, "name": "X", "output": false, "inverted": true}]}`)
+	if err := json.Unmarshal(b, &st); err != nil {
+		t.Fatal(err)
+	}
+	want := State{Output: 0xfffb, Inverted: 0x0004}
+	want.Names[2] = "X"
+	if !reflect.DeepEqual(st, want) {
+		t.Fatalf("%+v", st)
+	}
+	d, err = New(&bus, 0x20, WithNoInitialWrite())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Restore(st); err != nil {
+		t.Fatal(err)
+	}
+	if n := d.Pin(2).Name(); n != "X" {
+		t.Fatal(n)
+	}
+	if l, err := d.ReadOutput(2); l || err != nil {
+		t.Fatal(l, err)
+	}
+	if err := d.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, b := range []string{
+		`{"version": 2, "pins": []}`,
+		`{"version": 1, "pins": [{"index": 16}]}`,
+		`{"version": 1, "pins": [{"index": 1}, {"index": 1}]}`,
+		`{"version": 1, "pins": 1}`,
+	} {
+		if err := json.Unmarshal([]byte(b), &st); err == nil {
+			t.Fatal(b)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	bus := &i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x21, W: []byte{0xff, 0xff}},
+			{Addr: 0x21, W: []byte{0xff, 0xff}},
+		},
+		DontPanic: true,
+	}
+	opener := func() (i2c.BusCloser, error) {
+		return bus, nil
+	}
+	if err := i2creg.Register("pcf8575test", nil, 42, opener); err != nil {
+		t.Fatal(err)
+	}
+	defer i2creg.Unregister("pcf8575test")
+	if _, err := Open("pcf8575test:0xzz"); err == nil {
+		t.Fatal("invalid address")
+	}
+	if _, err := Open("unknown:0x20"); err == nil || !strings.HasPrefix(err.Error(), "pcf8575: open bus") {
+		t.Fatal(err)
+	}
+	// No device at 0x20.
+	if _, err := Open("42:0x20"); err == nil || !strings.HasPrefix(err.Error(), "pcf8575: write output") {
+		t.Fatal(err)
+	}
+	d, err := Open("pcf8575test:0x21")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPin_Halt(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0x00, 0x00}},
+			{Addr: 0x20, W: []byte{0x01, 0x00}},
+			{Addr: 0x20, W: []byte{0x01, 0x00}},
+			{Addr: 0x20, W: []byte{0xfd, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20, WithInitialState(0), WithSafeState(0xfffd))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.pins[0].Halt(); err != nil {
+		t.Fatal(err)
+	}
+	// P01 is low in the safe state.
+	if err := d.pins[1].Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNibble(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0x00, 0x00}},
+			{Addr: 0x20, W: []byte{0x00, 0x05}},
+			{Addr: 0x20, W: []byte{0x00, 0x0a}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20, WithInitialState(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Nibble([4]int{8, 9, 10, 16}); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if _, err := d.Nibble([4]int{8, 9, 10, 8}); err == nil {
+		t.Fatal("duplicate pin")
+	}
+	n, err := d.Nibble([4]int{8, 9, 10, 11})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := n.String(); s != "Nibble{PCF8575{0x20, out=0x0000}, [8 9 10 11]}" {
+		t.Fatal(s)
+	}
+	if err := n.Write(0xf5); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Write(0x0a); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xfe, 0xff}},
+			{Addr: 0x20, W: []byte{0xfe, 0xff}},
+			{Addr: 0x20, R: []byte{0xfc, 0x7f}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+		DontPanic: true,
+	}
+	d, err := New(&bus, 0x20, WithInitialState(0xfffe))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetNames(map[int]string{1: "BUTTON"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetDirection(1, false); err != nil {
+		t.Fatal(err)
+	}
+	d.SetInvertedMask(0x8000)
+	st, err := d.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Addr != 0x20 || st.Output != 0x7ffe || st.Input != 0xfffc || st.InputPins != 0x0002 || st.Inverted != 0x8000 {
+		t.Fatalf("%+v", st)
+	}
+	if st.Names[0] != "PCF8575_0x20_P00" || st.Names[1] != "BUTTON" {
+		t.Fatal(st.Names)
+	}
+	// The read fails, the cached state is still returned.
+	if st, err := d.Status(); err == nil || st.Output != 0x7ffe {
+		t.Fatal(st, err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDumpState(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xfe, 0xff}},
+			{Addr: 0x20, W: []byte{0xfe, 0xff}},
+			{Addr: 0x20, R: []byte{0xfc, 0x7f}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+		DontPanic: true,
+	}
+	d, err := New(&bus, 0x20, WithInitialState(0xfffe))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetNames(map[int]string{1: "BUTTON"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetDirection(1, false); err != nil {
+		t.Fatal(err)
+	}
+	d.SetInvertedMask(0x8000)
+	lines := strings.Split(d.DumpState(true), "\n")
+	if len(lines) != 18 {
+		t.Fatal(len(lines))
+	}
+	exp := []string{
+		"PIN  NAME              DIR  INV  OUT   IN",
+		"P00  PCF8575_0x20_P00  out  no   low   low",
+		"P01  BUTTON            in   no   high  low",
+		"P02  PCF8575_0x20_P02  out  no   high  high",
+	}
+	for i, e := range exp {
+		if lines[i] != e {
+			t.Fatalf("%q", lines[i])
+		}
+	}
+	if l := lines[16]; l != "P17  PCF8575_0x20_P17  out  yes  low   high" {
+		t.Fatalf("%q", l)
+	}
+	if s := d.DumpState(false); !strings.HasPrefix(s, "PIN  NAME              DIR  INV  OUT\n") {
+		t.Fatal(s)
+	}
+	// The read fails.
+	if s := d.DumpState(true); !strings.Contains(s, "pcf8575: read input:") || !strings.Contains(s, "low   ?\n") {
+		t.Fatal(s)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadRaw(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, R: []byte{0xfe, 0x7f}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+		DontPanic: true,
+	}
+	d, err := New(&bus, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.SetInvertedMask(0xffff)
+	if b, err := d.ReadRaw(); b != [2]byte{0xfe, 0x7f} || err != nil {
+		t.Fatal(b, err)
+	}
+	if _, err := d.ReadRaw(); err == nil {
+		t.Fatal("expected failure")
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithAutoReinit(t *testing.T) {
+	bus := bounceBus{v: 0xfe}
+	d, err := New(&bus, 0x20, WithInitialState(0xfffe), WithAutoReinit(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus.fails = 1
+	if _, err := d.ReadInput(1); err == nil {
+		t.Fatal("expected failure")
+	}
+	if _, err := d.ReadInput(1); err != nil {
+		t.Fatal(err)
+	}
+	if len(bus.writes) != 1 {
+		t.Fatal("not enough failures to reinit")
+	}
+	bus.fails = 2
+	for i := 0; i < 2; i++ {
+		if _, err := d.ReadInput(1); err == nil {
+			t.Fatal("expected failure")
+		}
+	}
+	if l, err := d.ReadInput(1); !l || err != nil {
+		t.Fatal(l, err)
+	}
+	if len(bus.writes) != 2 || bus.writes[1][0] != 0xfe || bus.reads != 3 {
+		t.Fatal(bus.writes, bus.reads)
+	}
+	if _, err := d.ReadInput(1); err != nil || len(bus.writes) != 2 {
+		t.Fatal("the failures are reset")
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(&bus, 0x21, WithAutoReinit(0)); err == nil {
+		t.Fatal("invalid failures")
+	}
+}
+
+func TestWithLogger(t *testing.T) {
+	bus := bounceBus{v: 0xfe}
+	var got []string
+	logger := func(format string, args ...interface{}) {
+		got = append(got, fmt.Sprintf(format, args...))
+	}
+	d, err := New(&bus, 0x20, WithRetry(2, time.Microsecond), WithAutoReinit(1), WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Fatal(got)
+	}
+	bus.fails = 1
+	if _, err := d.ReadInput(1); err != nil {
+		t.Fatal(err)
+	}
+	bus.fails = 2
+	if _, err := d.ReadInput(1); err == nil {
+		t.Fatal("expected failure")
+	}
+	if _, err := d.ReadInput(1); err != nil {
+		t.Fatal(err)
+	}
+	retry := "pcf8575 0x20: retry 1/1 in 1µs: " + syscall.ENXIO.Error()
+	want := []string{retry, retry, "pcf8575 0x20: restoring the outputs after 1 failures"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatal(got)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithHealthCheck(t *testing.T) {
+	bus := bounceBus{v: 0xfe}
+	results := make(chan error, 10)
+	d, err := New(&bus, 0x20, WithHealthCheck(time.Millisecond, func(err error) {
+		select {
+		case results <- err:
+		default:
+		}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-results; err != nil {
+		t.Fatal(err)
+	}
+	bus.Lock()
+	bus.err = syscall.ENXIO
+	bus.Unlock()
+	for {
+		if err := <-results; errors.Is(err, syscall.ENXIO) {
+			break
+		}
+	}
+	bus.Lock()
+	bus.err = nil
+	bus.Unlock()
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	bus.Lock()
+	n := bus.reads
+	bus.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	bus.Lock()
+	defer bus.Unlock()
+	if bus.reads != n {
+		t.Fatal("the health check must be stopped")
+	}
+	if _, err := New(&bus, 0x21, WithHealthCheck(0, nil)); err == nil {
+		t.Fatal("invalid health check")
+	}
+}
+
+func TestPing(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xfe, 0xff}},
+			{Addr: 0x20, R: []byte{0xfe, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+		DontPanic: true,
+	}
+	d, err := New(&bus, 0x20, WithInitialState(0xfffe))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Ping(); err == nil {
+		t.Fatal("expected failure")
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReserve(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Reserve(16, "lcd"); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if err := d.Reserve(0, ""); err == nil {
+		t.Fatal("owner must be set")
+	}
+	if err := d.Reserve(0, "lcd"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Reserve(0, "lcd"); err != nil {
+		t.Fatal(err)
+	}
+	err = d.Reserve(0, "keypad")
+	if !errors.Is(err, ErrReserved) {
+		t.Fatal(err)
+	}
+	if s := err.Error(); s != "PCF8575.Reserve: pin is reserved by \"lcd\" (0)" {
+		t.Fatal(s)
+	}
+	if err := d.Release(0, "keypad"); !errors.Is(err, ErrReserved) {
+		t.Fatal(err)
+	}
+	if o := d.Owner(0); o != "lcd" {
+		t.Fatal(o)
+	}
+	if err := d.Release(0, "lcd"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Reserve(0, "keypad"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Release(16, "keypad"); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if o := d.Owner(16); o != "" {
+		t.Fatal(o)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChain(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x21, W: []byte{0xff, 0xff}},
+			{Addr: 0x21, W: []byte{0xfd, 0xff}},
+			{Addr: 0x20, R: []byte{0xff, 0x7f}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x21, W: []byte{0xff, 0xff}},
+		},
+	}
+	d0, err := New(&bus, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d1, err := New(&bus, 0x21)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewChain(); err == nil {
+		t.Fatal("empty chain")
+	}
+	c, err := NewChain(d0, d1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := c.Len(); n != 32 || len(c.Pins()) != 32 {
+		t.Fatal(n)
+	}
+	if s := c.Pin(17).Name(); s != "PCF8575_0x21_P01" {
+		t.Fatal(s)
+	}
+	if c.Pin(32) != gpio.INVALID {
+		t.Fatal("expected INVALID")
+	}
+	if err := c.WriteOutput(17, false); err != nil {
+		t.Fatal(err)
+	}
+	if l, err := c.ReadOutput(17); l || err != nil {
+		t.Fatal(l, err)
+	}
+	if l, err := c.ReadInput(15); l || err != nil {
+		t.Fatal(l, err)
+	}
+	if err := c.WriteOutput(32, false); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if _, err := c.ReadInput(-1); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if s := c.String(); s != "PCF8575Chain{PCF8575{0x20, out=0xFFFF}, PCF8575{0x21, out=0xFFFD}}" {
+		t.Fatal(s)
+	}
+	if err := c.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLCD(t *testing.T) {
+	bus := i2ctest.Record{}
+	d, err := New(&bus, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewLCD(d, Backpack, 5); err == nil {
+		t.Fatal("invalid rows")
+	}
+	if _, err := NewLCD(d, LCDPins{RS: 0, RW: 0, EN: 2, D4: 4, D5: 5, D6: 6, D7: 7, Backlight: -1}, 2); err == nil {
+		t.Fatal("pin used twice")
+	}
+	if _, err := NewLCD(d, LCDPins{RS: 16, RW: 1, EN: 2, D4: 4, D5: 5, D6: 6, D7: 7, Backlight: -1}, 2); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	l, err := NewLCD(d, Backpack, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Init(); err != nil {
+		t.Fatal(err)
+	}
+	// 4 nibbles for the reset sequence, then 4 instructions, each being a
+	// single write.
+	if n := len(bus.Ops); n != 1+4+4 {
+		t.Fatal(n)
+	}
+	if err := l.SetCursor(3, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.SetCursor(0, 2); err == nil {
+		t.Fatal("invalid row")
+	}
+	start := len(bus.Ops)
+	if err := l.Print("A"); err != nil {
+		t.Fatal(err)
+	}
+	// 'A' is 0x41: D6, then D4; RS and the backlight are high, RW is low. The
+	// data is set up before EN is pulsed.
+	exp := []byte{0x49, 0xff, 0x4d, 0xff, 0x49, 0xff, 0x19, 0xff, 0x1d, 0xff, 0x19, 0xff}
+	if n := len(bus.Ops) - start; n != 1 {
+		t.Fatal(n)
+	}
+	if w := bus.Ops[start].W; !reflect.DeepEqual(w, exp) {
+		t.Fatal(w)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteMaskSequence(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0x00, 0x00}},
+			{Addr: 0x20, W: []byte{0x01, 0x00, 0x03, 0x00, 0x01, 0x00}},
+			{Addr: 0x20, W: []byte{0x04, 0x00}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20, WithInitialState(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteMaskSequence(0x0003, nil); err == nil {
+		t.Fatal("no states")
+	}
+	if err := d.WriteMaskSequence(0x0003, []uint16{0xffff &^ 2, 0xffff, 0xffff &^ 2}); err != nil {
+		t.Fatal(err)
+	}
+	if v := d.GetState(); v != 0x0001 {
+		t.Fatalf("0x%04x", v)
+	}
+	// Only the last state is staged.
+	d.Begin()
+	if err := d.WriteMaskSequence(0x0007, []uint16{0x0007, 0x0004}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeypad(t *testing.T) {
+	bus := matrixBus{}
+	d, err := New(&bus, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := [][]rune{{'1', '2'}, {'3', '4'}}
+	if _, err := NewKeypad(d, []int{0, 1}, []int{8}, keys); err == nil {
+		t.Fatal("layout mismatch")
+	}
+	if _, err := NewKeypad(d, []int{0, 1}, []int{8, 1}, keys); err == nil {
+		t.Fatal("pin used twice")
+	}
+	k, err := NewKeypad(d, []int{0, 1}, []int{8, 9}, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.SetDebounce(0)
+	if r, ok, err := k.Scan(); ok || err != nil {
+		t.Fatal(r, ok, err)
+	}
+	bus.pressed = [][2]int{{1, 8}}
+	if r, ok, err := k.Scan(); r != '3' || !ok || err != nil {
+		t.Fatal(r, ok, err)
+	}
+	// Ghosting.
+	bus.pressed = [][2]int{{1, 8}, {0, 9}}
+	if r, ok, err := k.Scan(); ok || err != nil {
+		t.Fatal(r, ok, err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSoftI2C(t *testing.T) {
+	bus := i2cSlaveBus{scl: 0, sda: 1, addr: 0x50, mem: []byte{0xab, 0xcd}}
+	d, err := New(&bus, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.SoftI2C(0, 0); err == nil {
+		t.Fatal("same pin")
+	}
+	if _, err := d.SoftI2C(0, 16); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	b, err := d.SoftI2C(0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetSpeed(0); err == nil {
+		t.Fatal("invalid speed")
+	}
+	r := make([]byte, 2)
+	if err := b.Tx(0x50, []byte{0x12, 0x34}, r); err != nil {
+		t.Fatal(err)
+	}
+	if r[0] != 0xab || r[1] != 0xcd {
+		t.Fatal(r)
+	}
+	if g := bus.got; len(g) != 2 || g[0] != 0x12 || g[1] != 0x34 {
+		t.Fatal(g)
+	}
+	if err := b.Tx(0x51, []byte{0x12}, nil); err == nil {
+		t.Fatal("expected NACK")
+	}
+	if err := b.Tx(0x80, nil, nil); err == nil {
+		t.Fatal("invalid address")
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSevenSeg(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0x00, 0x00}},
+			{Addr: 0x20, W: []byte{0x00, 0xdb}},
+			{Addr: 0x20, W: []byte{0xf9, 0xdb}},
+			{Addr: 0x20, W: []byte{0xff, 0xdb}},
+			{Addr: 0x20, W: []byte{0xff, 0x00}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20, WithInitialState(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSevenSeg(d, [8]int{0, 1, 2, 3, 4, 5, 6, 16}, false); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if _, err := NewSevenSeg(d, [8]int{0, 1, 2, 3, 4, 5, 6, 0}, false); err == nil {
+		t.Fatal("pin used twice")
+	}
+	cathode, err := NewSevenSeg(d, [8]int{8, 9, 10, 11, 12, 13, 14, 15}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anode, err := NewSevenSeg(d, [8]int{0, 1, 2, 3, 4, 5, 6, 7}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := cathode.String(); s != "SevenSeg{PCF8575{0x20, out=0x0000}}" {
+		t.Fatal(s)
+	}
+	if err := cathode.Show(0x10, false); err == nil {
+		t.Fatal("invalid digit")
+	}
+	if err := cathode.Show(2, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := anode.Show(1, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := anode.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cathode.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBargraph(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0x00, 0x00}},
+			{Addr: 0x20, W: []byte{0xe0, 0x00}},
+			{Addr: 0x20, W: []byte{0xe0, 0x01}},
+			{Addr: 0x20, W: []byte{0x00, 0x01}},
+			{Addr: 0x20, W: []byte{0x00, 0x00}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20, WithInitialState(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewBargraph(d, 10, 8, BarMode); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if _, err := NewBargraph(d, 0, 8, BargraphMode(2)); err == nil {
+		t.Fatal("invalid mode")
+	}
+	bar, err := NewBargraph(d, 5, 4, BarMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dot, err := NewBargraph(d, 5, 4, DotMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := bar.String(); s != "Bargraph{PCF8575{0x20, out=0x0000}}" {
+		t.Fatal(s)
+	}
+	if err := bar.Set(5); err == nil {
+		t.Fatal("invalid level")
+	}
+	if err := bar.Set(3); err != nil {
+		t.Fatal(err)
+	}
+	if err := bar.Set(4); err != nil {
+		t.Fatal(err)
+	}
+	if err := dot.Set(4); err != nil {
+		t.Fatal(err)
+	}
+	if err := dot.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClock(t *testing.T) {
+	d, err := New(&nopBus{}, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &fakeClock{}
+	l, err := NewLCD(d, Backpack, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.SetClock(c)
+	if err := l.Init(); err != nil {
+		t.Fatal(err)
+	}
+	want := []time.Duration{4100 * time.Microsecond, 100 * time.Microsecond, 100 * time.Microsecond, 2 * time.Millisecond}
+	if !reflect.DeepEqual(c.waits, want) {
+		t.Fatal(c.waits)
+	}
+
+	c = &fakeClock{}
+	s, err := NewStepper(d, [4]int{8, 9, 10, 11}, FullStep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetClock(c)
+	if err := s.Step(3, Forward, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	// No wait after the last step.
+	if want := []time.Duration{time.Second, time.Second}; !reflect.DeepEqual(c.waits, want) {
+		t.Fatal(c.waits)
+	}
+
+	c = &fakeClock{}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if d, err = New(&nopBus{}, 0x20, WithClock(c)); err != nil {
+		t.Fatal(err)
+	}
+	stop, err := d.PWM(0, 0.25, 4*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		c.Lock()
+		n := len(c.waits)
+		c.Unlock()
+		if n >= 4 {
+			break
+		}
+		runtime.Gosched()
+	}
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+	want = []time.Duration{time.Millisecond, 3 * time.Millisecond, time.Millisecond, 3 * time.Millisecond}
+	if !reflect.DeepEqual(c.waits[:4], want) {
+		t.Fatal(c.waits)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(&nopBus{}, 0x21, WithClock(nil)); err == nil {
+		t.Fatal("invalid clock")
+	}
+}
+
+func TestStepper(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0x00, 0x00}},
+			// Forward: 0x6, 0xc on pins 8 to 11.
+			{Addr: 0x20, W: []byte{0x00, 0x06}},
+			{Addr: 0x20, W: []byte{0x00, 0x0c}},
+			// Negative n: 0x6.
+			{Addr: 0x20, W: []byte{0x00, 0x06}},
+			{Addr: 0x20, W: []byte{0x00, 0x00}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20, WithInitialState(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewStepper(d, [4]int{8, 9, 10, 10}, FullStep); err == nil {
+		t.Fatal("pin used twice")
+	}
+	if _, err := NewStepper(d, [4]int{8, 9, 10, 11}, StepMode(2)); err == nil {
+		t.Fatal("invalid mode")
+	}
+	s, err := NewStepper(d, [4]int{8, 9, 10, 11}, FullStep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Step(2, Forward, time.Microsecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Step(-1, Forward, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Step(1, Direction(0), 0); err == nil {
+		t.Fatal("invalid direction")
+	}
+	if err := s.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	bus := bounceBus{v: 0xfc}
+	d, err := New(&bus, 0x20, WithPollInterval(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewEncoder(d, 0, 0); err == nil {
+		t.Fatal("pin used twice")
+	}
+	e, err := NewEncoder(d, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A full cycle forward, then one step backward.
+	for i, v := range []byte{0xfd, 0xff, 0xfe, 0xfc, 0xfe} {
+		bus.Lock()
+		bus.v = v
+		bus.Unlock()
+		exp := []int{1, 2, 3, 4, 3}[i]
+		for p := range e.Changed() {
+			if p == exp {
+				break
+			}
+		}
+	}
+	if p := e.Position(); p != 3 {
+		t.Fatal(p)
+	}
+	if err := e.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-e.Changed(); ok {
+		t.Fatal("Changed must be closed")
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadInputs(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, R: []byte{0x01, 0x80}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in, err := d.ReadInputs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, l := range in {
+		if l != (i == 0 || i == 15) {
+			t.Fatal(i, l)
+		}
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteOutputs(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xfe, 0x7f}},
+			{Addr: 0x20, W: []byte{0xff, 0x7f}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteOutputs(map[int]bool{0: false, 1: true, 15: false}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteOutputs(map[int]bool{2: false, 16: false}); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if l, err := d.ReadOutput(2); !l || err != nil {
+		t.Fatal("state must be unchanged")
+	}
+	if err := d.SetMultiple(map[int]bool{0: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetMultiple(map[int]bool{-1: true}); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadInput_latched(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xfe, 0xff}},
+			// Latched high.
+			{Addr: 0x20, R: []byte{0xfc, 0xff}},
+			// Latched low.
+			{Addr: 0x20, R: []byte{0xfc, 0xff}},
+			// In() latches the pin high first.
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, R: []byte{0xff, 0xff}},
+			// Already latched high.
+			{Addr: 0x20, R: []byte{0xfe, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20, WithInitialState(0xfffe))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l, err := d.ReadInput(1); l || err != nil {
+		t.Fatal(l, err)
+	}
+	if l, err := d.ReadInput(0); l || !errors.Is(err, ErrLatchedLow) {
+		t.Fatal(l, err)
+	}
+	if l, err := d.In(0); !l || err != nil {
+		t.Fatal(l, err)
+	}
+	if l, err := d.In(0); l || err != nil {
+		t.Fatal(l, err)
+	}
+	if _, err := d.In(16); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xf5, 0xfe}},
+			{Addr: 0x20, R: []byte{0x34, 0x12}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var g gpio.Group = d
+	if err := g.Out(0x010f, 0x0005); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := g.Read(0xff00); v != 0x1200 || err != nil {
+		t.Fatal(v, err)
+	}
+	if err := g.Out(0x10000, 0); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if _, err := g.Read(0x10000); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadOutputLatch(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			// P00 is pulled low externally.
+			{Addr: 0x20, R: []byte{0xfe, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l, err := d.ReadInput(0); l || err != nil {
+		t.Fatal(l, err)
+	}
+	if l, err := d.ReadOutputLatch(0); !l || err != nil {
+		t.Fatal(l, err)
+	}
+	if l, err := d.ReadOutput(0); !l || err != nil {
+		t.Fatal(l, err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetDirection(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0x00, 0x00}},
+			{Addr: 0x20, W: []byte{0x01, 0x00}},
+			{Addr: 0x20, W: []byte{0x01, 0x00}},
+			{Addr: 0x20, W: []byte{0x01, 0x00}},
+			{Addr: 0x20, W: []byte{0x00, 0x00}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20, WithInitialState(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetDirection(16, false); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if err := d.SetDirection(0, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteOutput(0, false); !errors.Is(err, ErrDirection) {
+		t.Fatal(err)
+	}
+	if _, err := d.Toggle(0); !errors.Is(err, ErrDirection) {
+		t.Fatal(err)
+	}
+	// P00 is kept high.
+	if err := d.WriteOutputs(map[int]bool{0: false, 1: false}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteAll(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetDirection(0, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteOutput(0, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetInverted(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			// WriteOutput(0, true) on an inverted pin latches it low.
+			{Addr: 0x20, W: []byte{0xfe, 0xff}},
+			{Addr: 0x20, R: []byte{0xfe, 0xff}},
+			// WriteAll(0) with P00 and P10 inverted.
+			{Addr: 0x20, W: []byte{0x01, 0x01}},
+			{Addr: 0x20, R: []byte{0x01, 0x01}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetInverted(0, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetInverted(16, true); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if err := d.WriteOutput(0, true); err != nil {
+		t.Fatal(err)
+	}
+	if l, err := d.ReadOutput(0); !l || err != nil {
+		t.Fatal(l, err)
+	}
+	if f := d.Pin(0).Function(); f != "Out/Low" {
+		t.Fatal(f)
+	}
+	if l, err := d.ReadInput(0); !l || !errors.Is(err, ErrLatchedLow) {
+		t.Fatal(l, err)
+	}
+	d.SetInvertedMask(0x0101)
+	if err := d.WriteAll(0); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := d.ReadAll(); v != 0 || err != nil {
+		t.Fatal(v, err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPWM(t *testing.T) {
+	bus := i2ctest.Record{}
+	d, err := New(&bus, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.PWM(16, 0.5, time.Millisecond); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if _, err := d.PWM(0, 1.5, time.Millisecond); err == nil {
+		t.Fatal("invalid duty")
+	}
+	if _, err := d.PWM(0, 0.5, 0); err == nil {
+		t.Fatal("invalid period")
+	}
+	stop, err := d.PWM(0, 0.5, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+	bus.Lock()
+	ops := bus.Ops
+	bus.Unlock()
+	if len(ops) < 3 {
+		t.Fatal(ops)
+	}
+	for i, op := range ops[1:] {
+		if exp := []byte{0xff - byte(i%2), 0xff}; op.W[0] != exp[0] || op.W[1] != exp[1] {
+			t.Fatal(i, op)
+		}
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPWM_errors(t *testing.T) {
+	bus := bounceBus{v: 0xff}
+	d, err := New(&bus, 0x20, WithClock(&fakeClock{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetDirection(1, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.PWM(1, 0.5, time.Millisecond); !errors.Is(err, ErrDirection) {
+		t.Fatal(err)
+	}
+	bus.Lock()
+	bus.err = errors.New("bus failure")
+	bus.Unlock()
+	stop, err := d.PWM(0, 0.5, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stop(); !errors.Is(err, bus.err) {
+		t.Fatal(err)
+	}
+	if err := stop(); !errors.Is(err, bus.err) {
+		t.Fatal(err)
+	}
+	bus.Lock()
+	bus.err = nil
+	bus.Unlock()
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFlash(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xfe, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xfe, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Flash(16, 1, 0, 0); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if err := d.Flash(0, -1, 0, 0); err == nil {
+		t.Fatal("invalid count")
+	}
+	if err := d.Flash(0, 2, time.Microsecond, time.Microsecond); err != nil {
+		t.Fatal(err)
+	}
+	if l, err := d.ReadOutput(0); !l || err != nil {
+		t.Fatal(l, err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChase(t *testing.T) {
+	bus := bounceBus{v: 0xff}
+	d, err := New(&bus, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Chase(nil, time.Millisecond, nil); err == nil {
+		t.Fatal("no pins")
+	}
+	if err := d.Chase([]int{0}, 0, nil); err == nil {
+		t.Fatal("invalid interval")
+	}
+	if err := d.Chase([]int{0, 16}, time.Millisecond, nil); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if err := d.WriteOutput(3, false); err != nil {
+		t.Fatal(err)
+	}
+	bus.writes = nil
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- d.Chase([]int{0, 1, 3}, time.Microsecond, stop)
+	}()
+	for {
+		bus.Lock()
+		n := len(bus.writes)
+		bus.Unlock()
+		if n >= 4 {
+			break
+		}
+		time.Sleep(time.Microsecond)
+	}
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	want := [][]byte{{0xf5, 0xff}, {0xf6, 0xff}, {0xfc, 0xff}, {0xf5, 0xff}}
+	if !reflect.DeepEqual(bus.writes[:4], want) {
+		t.Fatal(bus.writes)
+	}
+	// The original levels are restored.
+	if w := bus.writes[len(bus.writes)-1]; w[0] != 0xf7 || w[1] != 0xff {
+		t.Fatal(w)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	bus := matrixBus{}
+	d, err := New(&bus, 0x20, WithInitialState(0x1234))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SelfTest(); err != nil {
+		t.Fatal(err)
+	}
+	if bus.out != 0x1234 {
+		t.Fatalf("state not restored: 0x%04x", bus.out)
+	}
+	// A short between P02 and P05.
+	bus.pressed = [][2]int{{2, 5}}
+	err = d.SelfTest()
+	if !errors.Is(err, ErrVerify) {
+		t.Fatal(err)
+	}
+	if s := err.Error(); s != "PCF8575.SelfTest: output readback mismatch on pin 2 (read 0xffdb, expected 0xfffb)" {
+		t.Fatal(s)
+	}
+	if bus.out != 0x1234 {
+		t.Fatalf("state not restored: 0x%04x", bus.out)
+	}
+	if err := d.SetDirection(3, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SelfTest(); !errors.Is(err, ErrDirection) {
+		t.Fatal(err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xfe, 0xff}},
+			{Addr: 0x20, W: []byte{0x00, 0x00}},
+			{Addr: 0x20, W: []byte{0xfe, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20, WithInitialState(0xfffe))
+	if err != nil {
+		t.Fatal(err)
+	}
+	restore := d.Snapshot()
+	if err := d.WriteAll(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := restore(); err != nil {
+		t.Fatal(err)
+	}
+	// Only the first call writes.
+	if err := restore(); err != nil {
+		t.Fatal(err)
+	}
+	if s := d.GetState(); s != 0xfffe {
+		t.Fatalf("0x%04x", s)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPulse(t *testing.T) {
+	bus := i2ctest.Playback{
+		Ops: []i2ctest.IO{
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xfe}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+			{Addr: 0x20, W: []byte{0xff, 0xff}},
+		},
+	}
+	d, err := New(&bus, 0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Pulse(16, false, time.Millisecond); !errors.Is(err, ErrPinRange) {
+		t.Fatal(err)
+	}
+	if err := d.Pulse(8, false, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if l, err := d.ReadOutput(8); !l || err != nil {
+		t.Fatal(l, err)
+	}
+	if err := d.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//
+
+func BenchmarkWriteOutput(b *testing.B) {
+	d := newBenchDev(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = d.WriteOutput(i&15, i&16 != 0)
+	}
+}
+
+func BenchmarkReadInput(b *testing.B) {
+	d := newBenchDev(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = d.ReadInput(i & 15)
+	}
+}
+
+func BenchmarkWriteAll(b *testing.B) {
+	d := newBenchDev(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = d.WriteAll(uint16(i))
+	}
+}
+
+func BenchmarkReadAll(b *testing.B) {
+	d := newBenchDev(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = d.ReadAll()
+	}
+}
+
+//
+
+// scanBus acknowledges the addresses in acks and fails the others with a
+// NACK, or with err after the first acknowledged address if set.
+type scanBus struct {
+	acks map[uint16]bool
+	err  error
+	seen bool
+}
+
+func (s *scanBus) String() string {
+	return "scan"
+}
+
+func (s *scanBus) Tx(addr uint16, w, r []byte) error {
+	if s.acks[addr] {
+		s.seen = true
+		return nil
+	}
+	if s.seen && s.err != nil {
+		return s.err
+	}
+	return syscall.ENXIO
+}
+
+func (s *scanBus) SetSpeed(hz int64) error {
+	return nil
+}
+
+// bounceBus returns v on reads, flipping bit 0 after every read if bounce is
+// set, or fails with err if set. The first fails transactions fail with a
+// NACK.
+type bounceBus struct {
+	sync.Mutex
+	v      byte
+	bounce bool
+	err    error
+	fails  int
+	writes [][]byte
+	reads  int
+}
+
+func (b *bounceBus) String() string {
+	return "bounce"
+}
+
+func (b *bounceBus) Tx(addr uint16, w, r []byte) error {
+	b.Lock()
+	defer b.Unlock()
+	if b.err != nil {
+		return b.err
+	}
+	if b.fails > 0 {
+		b.fails--
+		return syscall.ENXIO
+	}
+	if len(w) != 0 {
+		b.writes = append(b.writes, append([]byte(nil), w...))
+	}
+	if len(r) != 0 {
+		b.reads++
+		r[0] = b.v
+		r[1] = 0xff
+		if b.bounce {
+			b.v ^= 1
+		}
+	}
+	return nil
+}
+
+func (b *bounceBus) SetSpeed(hz int64) error {
+	return nil
+}
+
+// matrixBus simulates a key matrix: the column pin of each pressed key reads
+// low when its row pin is latched low.
+type matrixBus struct {
+	out     uint16
+	pressed [][2]int
+}
+
+func (m *matrixBus) String() string {
+	return "matrix"
+}
+
+func (m *matrixBus) Tx(addr uint16, w, r []byte) error {
+	if len(w) != 0 {
+		m.out = uint16(w[0]) | uint16(w[1])<<8
+	}
+	if len(r) != 0 {
+		v := m.out
+		for _, p := range m.pressed {
+			if m.out&(1<<uint(p[0])) == 0 {
+				v &^= 1 << uint(p[1])
+			}
+		}
+		r[0] = byte(v)
+		r[1] = byte(v >> 8)
+	}
+	return nil
+}
+
+func (m *matrixBus) SetSpeed(hz int64) error {
+	return nil
+}
+
+// i2cSlaveBus simulates an I²C slave at addr connected to the expander's pins
+// scl and sda. It records the bytes written to it in got and returns mem on
+// reads.
+type i2cSlaveBus struct {
+	scl, sda int
+	addr     byte
+	mem      []byte
+	got      []byte
+
+	out      uint16 // Expander's output latch
+	drive    bool   // The slave pulls SDA low
+	prevSCL  bool
+	prevSDA  bool
+	active   bool // Between a start condition and the end of the transfer
+	addrDone bool // The address byte was received
+	sending  bool // Sending mem to the master
+	ack      bool // In the 9th clock
+	bits     int
+	cur      byte
+	next     int // Next byte of mem to send
+}
+
+func (s *i2cSlaveBus) String() string {
+	return "i2cslave"
+}
+
+func (s *i2cSlaveBus) Tx(addr uint16, w, r []byte) error {
+	if len(w) != 0 {
+		s.out = uint16(w[0]) | uint16(w[1])<<8
+		s.update()
+	}
+	if len(r) != 0 {
+		v := s.out
+		if _, sda := s.lines(); !sda {
+			v &^= 1 << uint(s.sda)
+		}
+		r[0] = byte(v)
+		r[1] = byte(v >> 8)
+	}
+	return nil
+}
+
+func (s *i2cSlaveBus) SetSpeed(hz int64) error {
+	return nil
+}
+
+func (s *i2cSlaveBus) lines() (bool, bool) {
+	return s.out&(1<<uint(s.scl)) != 0, s.out&(1<<uint(s.sda)) != 0 && !s.drive
+}
+
+func (s *i2cSlaveBus) update() {
+	scl, sda := s.lines()
+	switch {
+	case scl && s.prevSCL && s.prevSDA && !sda:
+		// Start.
+		s.active, s.addrDone, s.sending, s.ack, s.bits, s.cur = true, false, false, false, 0, 0
+	case scl && s.prevSCL && !s.prevSDA && sda:
+		// Stop.
+		s.active = false
+		s.drive = false
+	case scl && !s.prevSCL && s.active:
+		if s.ack {
+			if s.sending && sda {
+				// NACK from the master, stop sending.
+				s.active = false
+			}
+		} else if !s.sending {
+			s.cur = s.cur<<1 | b2u(sda)
+			s.bits++
+		}
+	case !scl && s.prevSCL:
+		s.falling()
+	}
+	s.prevSCL, s.prevSDA = s.lines()
+}
+
+func (s *i2cSlaveBus) falling() {
+	if s.ack {
+		s.ack = false
+		s.drive = false
+		if s.sending && s.active {
+			s.bits = 0
+			s.drive = s.mem[s.next]&0x80 == 0
+		}
+		return
+	}
+	if !s.active {
+		s.drive = false
+		return
+	}
+	if s.sending {
+		s.bits++
+		if s.bits < 8 {
+			s.drive = s.mem[s.next]&(0x80>>uint(s.bits)) == 0
+		} else {
+			s.next++
+			s.drive = false
+			s.ack = true
+		}
+		return
+	}
+	if s.bits != 8 {
+		return
+	}
+	if !s.addrDone {
+		s.addrDone = true
+		if s.cur>>1 != s.addr {
+			s.active = false
+			s.bits, s.cur = 0, 0
+			return
+		}
+		s.sending = s.cur&1 != 0
+	} else {
+		s.got = append(s.got, s.cur)
+	}
+	s.bits, s.cur = 0, 0
+	s.drive = true
+	s.ack = true
+}
+
+func b2u(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// fakeClock is a Clock whose time only advances when waiting. It records the
+// waits.
+type fakeClock struct {
+	sync.Mutex
+	now   time.Time
+	waits []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	c.now = c.now.Add(d)
+	c.waits = append(c.waits, d)
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.Sleep(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.Now()
+	return ch
+}
+
+// gateClock is a fakeClock whose After blocks until the test sends on release.
+// The durations waited for are sent on waiting.
+type gateClock struct {
+	fakeClock
+	waiting chan time.Duration
+	release chan time.Time
+}
+
+func (c *gateClock) After(d time.Duration) <-chan time.Time {
+	c.waiting <- d
+	return c.release
+}
+
+// nopBus is a fake bus that ignores writes and reads all high.
+type nopBus struct{}
+
+func (nopBus) String() string {
+	return "nop"
+}
+
+func (nopBus) Tx(addr uint16, w, r []byte) error {
+	for i := range r {
+		r[i] = 0xff
+	}
+	return nil
+}
+
+func (nopBus) SetSpeed(hz int64) error {
+	return nil
+}
+
+// newBenchDev returns a Dev on a nopBus that is halted at the end of b.
+func newBenchDev(b *testing.B) *Dev {
+	d, err := New(nopBus{}, 0x20)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() {
+		if err := d.Halt(); err != nil {
+			b.Fatal(err)
+		}
+	})
+	return d
+}
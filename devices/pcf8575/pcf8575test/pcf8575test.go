@@ -0,0 +1,147 @@
+// Copyright 2017 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Package pcf8575test is meant to be used to test code using a PCF8575
+// without a device.
+package pcf8575test
+
+import (
+	"fmt"
+	"sync"
+
+	"periph.io/x/periph/devices/pcf8575"
+)
+
+// Fake implements pcf8575.Expander with an in-memory port.
+//
+// The input levels are set with SetInput and are independent of the outputs:
+// the quasi-bidirectional pins are not modeled unless QuasiBidirectional is
+// set.
+type Fake struct {
+	sync.Mutex
+	// QuasiBidirectional makes the pins latched low read low, like the device.
+	// ReadInput then returns pcf8575.ErrLatchedLow for these pins.
+	QuasiBidirectional bool
+	// Out is the output latch, with the same bit ordering as
+	// pcf8575.Dev.WriteAll.
+	Out uint16
+	// In is the levels applied to the pins by the external circuit.
+	In uint16
+	// Halted is set by Halt.
+	Halted bool
+}
+
+// NewFake returns a Fake in the device's power-on state, all outputs high,
+// with all the inputs high.
+func NewFake() *Fake {
+	return &Fake{Out: 0xffff, In: 0xffff}
+}
+
+func (f *Fake) String() string {
+	f.Lock()
+	defer f.Unlock()
+	return fmt.Sprintf("Fake{out=0x%04X}", f.Out)
+}
+
+// Halt sets all the outputs high and sets Halted.
+func (f *Fake) Halt() error {
+	f.Lock()
+	defer f.Unlock()
+	f.Out = 0xffff
+	f.Halted = true
+	return nil
+}
+
+// SetInput sets the level applied to the pin at index by the external
+// circuit.
+func (f *Fake) SetInput(index int, level bool) error {
+	f.Lock()
+	defer f.Unlock()
+	if !valid(index) {
+		return fmt.Errorf("Fake.SetInput: %w (%d)", pcf8575.ErrPinRange, index)
+	}
+	f.In = set(f.In, index, level)
+	return nil
+}
+
+// WriteOutput implements pcf8575.Expander.
+func (f *Fake) WriteOutput(index int, state bool) error {
+	f.Lock()
+	defer f.Unlock()
+	if !valid(index) {
+		return fmt.Errorf("Fake.WriteOutput: %w (%d)", pcf8575.ErrPinRange, index)
+	}
+	f.Out = set(f.Out, index, state)
+	return nil
+}
+
+// ReadOutput implements pcf8575.Expander.
+func (f *Fake) ReadOutput(index int) (bool, error) {
+	f.Lock()
+	defer f.Unlock()
+	if !valid(index) {
+		return false, fmt.Errorf("Fake.ReadOutput: %w (%d)", pcf8575.ErrPinRange, index)
+	}
+	return f.Out&(1<<uint(index)) != 0, nil
+}
+
+// ReadInput implements pcf8575.Expander.
+func (f *Fake) ReadInput(index int) (bool, error) {
+	f.Lock()
+	defer f.Unlock()
+	if !valid(index) {
+		return false, fmt.Errorf("Fake.ReadInput: %w (%d)", pcf8575.ErrPinRange, index)
+	}
+	l := f.levels()&(1<<uint(index)) != 0
+	if f.QuasiBidirectional && f.Out&(1<<uint(index)) == 0 {
+		return l, fmt.Errorf("Fake.ReadInput: %w (%d)", pcf8575.ErrLatchedLow, index)
+	}
+	return l, nil
+}
+
+// WriteAll sets all the outputs, like pcf8575.Dev.WriteAll.
+func (f *Fake) WriteAll(state uint16) error {
+	f.Lock()
+	defer f.Unlock()
+	f.Out = state
+	return nil
+}
+
+// WriteMask sets the outputs selected by mask, like pcf8575.Dev.WriteMask.
+func (f *Fake) WriteMask(mask, values uint16) error {
+	f.Lock()
+	defer f.Unlock()
+	f.Out = f.Out&^mask | values&mask
+	return nil
+}
+
+// ReadAll returns the level of all the pins, like pcf8575.Dev.ReadAll.
+func (f *Fake) ReadAll() (uint16, error) {
+	f.Lock()
+	defer f.Unlock()
+	return f.levels(), nil
+}
+
+//
+
+// levels returns the levels read on the pins.
+func (f *Fake) levels() uint16 {
+	if f.QuasiBidirectional {
+		return f.In & f.Out
+	}
+	return f.In
+}
+
+func valid(index int) bool {
+	return index >= 0 && index < pcf8575.PinCount
+}
+
+func set(v uint16, index int, l bool) uint16 {
+	if l {
+		return v | 1<<uint(index)
+	}
+	return v &^ (1 << uint(index))
+}
+
+var _ pcf8575.Expander = &Fake{}
@@ -0,0 +1,77 @@
+// Copyright 2017 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package pcf8575test
+
+import (
+	"errors"
+	"testing"
+
+	"periph.io/x/periph/devices/pcf8575"
+)
+
+func TestFake(t *testing.T) {
+	f := NewFake()
+	if err := f.WriteOutput(0, false); err != nil {
+		t.Fatal(err)
+	}
+	if l, err := f.ReadOutput(0); l || err != nil {
+		t.Fatal(l, err)
+	}
+	// The outputs don't affect the inputs by default.
+	if l, err := f.ReadInput(0); !l || err != nil {
+		t.Fatal(l, err)
+	}
+	if err := f.SetInput(1, false); err != nil {
+		t.Fatal(err)
+	}
+	if l, err := f.ReadInput(1); l || err != nil {
+		t.Fatal(l, err)
+	}
+	if err := f.WriteMask(0x8001, 0x8000); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := f.ReadAll(); v != 0xfffd || err != nil {
+		t.Fatal(v, err)
+	}
+	if err := f.WriteAll(0x1234); err != nil {
+		t.Fatal(err)
+	}
+	if s := f.String(); s != "Fake{out=0x1234}" {
+		t.Fatal(s)
+	}
+	if err := f.Halt(); err != nil || !f.Halted || f.Out != 0xffff {
+		t.Fatal(err)
+	}
+}
+
+func TestFake_QuasiBidirectional(t *testing.T) {
+	f := NewFake()
+	f.QuasiBidirectional = true
+	if err := f.WriteOutput(0, false); err != nil {
+		t.Fatal(err)
+	}
+	if l, err := f.ReadInput(0); l || !errors.Is(err, pcf8575.ErrLatchedLow) {
+		t.Fatal(l, err)
+	}
+	if v, err := f.ReadAll(); v != 0xfffe || err != nil {
+		t.Fatal(v, err)
+	}
+}
+
+func TestFake_PinRange(t *testing.T) {
+	f := NewFake()
+	if err := f.WriteOutput(16, true); !errors.Is(err, pcf8575.ErrPinRange) {
+		t.Fatal(err)
+	}
+	if _, err := f.ReadOutput(-1); !errors.Is(err, pcf8575.ErrPinRange) {
+		t.Fatal(err)
+	}
+	if _, err := f.ReadInput(16); !errors.Is(err, pcf8575.ErrPinRange) {
+		t.Fatal(err)
+	}
+	if err := f.SetInput(16, true); !errors.Is(err, pcf8575.ErrPinRange) {
+		t.Fatal(err)
+	}
+}
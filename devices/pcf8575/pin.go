@@ -0,0 +1,203 @@
+// Copyright 2017 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package pcf8575
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"periph.io/x/periph/conn/gpio"
+)
+
+// Pin is a single pin of a PCF8575 exposed as a gpio.PinIO.
+//
+// The PCF8575 pins are quasi-bidirectional: there is no direction register.
+// A pin latched high is weakly pulled up and can be used as an input, a pin
+// latched low strongly sinks current.
+type Pin struct {
+	d     *Dev
+	index int
+
+	// Protected by d.mu.
+	edge gpio.Edge // Edge as set by In
+	last bool      // Last level seen by In or WaitForEdge
+}
+
+func (p *Pin) String() string {
+	return p.Name()
+}
+
+// Name returns the alias set with Dev.SetNames if any, otherwise the default
+// name of the pin, e.g. PCF8575_0x20_P00.
+//
+// The suffix is the datasheet name of the pin, P00 to P07 then P10 to P17.
+func (p *Pin) Name() string {
+	p.d.nameMu.Lock()
+	n := p.d.names[p.index]
+	p.d.nameMu.Unlock()
+	if n != "" {
+		return n
+	}
+	return fmt.Sprintf("PCF8575_0x%02x_P%d%d", p.d.addr, p.index/8, p.index%8)
+}
+
+// Number returns a number unique to this pin across all the PCF8575 on a bus
+// so it can be registered in gpioreg alongside the host's own pins.
+//
+// It is numberBase + PinCount*address + index, where index is between 0 (P00)
+// and 15 (P17).
+func (p *Pin) Number() int {
+	return numberBase + PinCount*int(p.d.addr) + p.index
+}
+
+// Function returns "Out/Low" when the pin is latched low, "In/High" otherwise.
+//
+// The level is the physical one, regardless of Dev.SetInverted. It doesn't do
+// any I/O.
+func (p *Pin) Function() string {
+	p.d.mu.Lock()
+	l := p.d.latchedHigh(p.index)
+	p.d.unlock()
+	if !l {
+		return "Out/Low"
+	}
+	return "In/High"
+}
+
+// In latches the pin physically high so it can be read as an input.
+//
+// The pull is fixed by the hardware and cannot be changed, an error is
+// returned for gpio.PullDown. Edge detection requires the INT pin to be
+// connected, see WithInterruptPin.
+func (p *Pin) In(pull gpio.Pull, edge gpio.Edge) error {
+	if pull == gpio.PullDown {
+		return errors.New("pcf8575: pull-down is not supported")
+	}
+	if edge != gpio.NoEdge && p.d.intPin == nil {
+		return errors.New("pcf8575: edge detection requires the INT pin")
+	}
+	p.d.mu.Lock()
+	defer p.d.unlock()
+	p.d.setWire(p.index, true)
+	if err := p.d.commit(context.Background()); err != nil {
+		return err
+	}
+	l := false
+	if edge != gpio.NoEdge {
+		var err error
+		if l, err = p.d.readInput(context.Background(), p.index); err != nil {
+			return err
+		}
+	}
+	p.edge = edge
+	p.last = l
+	return nil
+}
+
+// Read returns the current level of the pin as sampled on the bus.
+//
+// Returns gpio.Low if the I²C transaction failed.
+func (p *Pin) Read() gpio.Level {
+	l, err := p.d.readPin(p.index)
+	if err != nil {
+		return gpio.Low
+	}
+	return gpio.Level(l)
+}
+
+// WaitForEdge waits for the INT pin to signal a change and returns true if
+// this pin changed according to the edge passed to In.
+//
+// It returns false immediately if edge detection wasn't enabled with In.
+func (p *Pin) WaitForEdge(timeout time.Duration) bool {
+	p.d.mu.Lock()
+	edge := p.edge
+	p.d.unlock()
+	if edge == gpio.NoEdge {
+		return false
+	}
+	var deadline time.Time
+	if timeout >= 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	for {
+		t := time.Duration(-1)
+		if timeout >= 0 {
+			if t = deadline.Sub(time.Now()); t < 0 {
+				return false
+			}
+		}
+		if !p.d.intPin.WaitForEdge(t) {
+			return false
+		}
+		l, err := p.d.readPin(p.index)
+		if err != nil {
+			return false
+		}
+		p.d.mu.Lock()
+		changed := l != p.last
+		p.last = l
+		p.d.unlock()
+		if changed && (edge == gpio.BothEdges || (edge == gpio.RisingEdge) == l) {
+			return true
+		}
+	}
+}
+
+// Pull returns gpio.PullUp, the pins have a weak internal pull-up when latched
+// high.
+//
+// The pull-up is a current source of about 100µA, after a brief strong pull-up
+// when the pin is latched high, so an external circuit pulling the pin low
+// must sink at least this current. It can't be disabled.
+func (p *Pin) Pull() gpio.Pull {
+	return gpio.PullUp
+}
+
+// DefaultPull implements gpio.PinDefaultPull.
+//
+// It returns gpio.PullUp like Pull since the pull can't be changed.
+func (p *Pin) DefaultPull() gpio.Pull {
+	return gpio.PullUp
+}
+
+// Drive returns the maximum current in µA sunk by the pin when latched low
+// and sourced by the pin when latched high, i.e. SinkCurrent and
+// SourceCurrent.
+//
+// The asymmetry is why a LED wired between the pin and ground is dim: it must
+// be wired between VDD and the pin and lit by latching the pin low.
+func (p *Pin) Drive() (sink, source int) {
+	return SinkCurrent, SourceCurrent
+}
+
+// Out latches the pin to the level l.
+//
+// Only the low level is driven strongly, see Drive.
+func (p *Pin) Out(l gpio.Level) error {
+	return p.d.WriteOutput(p.index, bool(l))
+}
+
+// Halt sets the pin to its level in the safe state, see WithSafeState, high
+// by default. The other pins are left unchanged.
+//
+// It is useful when the pins are handed out to libraries that halt them one
+// at a time. Use Dev.Halt to halt the whole device.
+func (p *Pin) Halt() error {
+	p.d.mu.Lock()
+	defer p.d.unlock()
+	m := uint16(1) << uint(p.index)
+	p.d.port.SetWord(p.d.port.Word()&^m | p.d.safe&m)
+	return p.d.commit(context.Background())
+}
+
+// numberBase is the first pin number used by the PCF8575 pins, well above the
+// GPIO numbers used by the hosts.
+const numberBase = 1000
+
+var _ gpio.PinIO = &Pin{}
+var _ gpio.PinDefaultPull = &Pin{}
@@ -0,0 +1,72 @@
+// Copyright 2017 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package pcf8575
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// PWM starts a software PWM on the pin at index, driving it high for duty
+// times period then low for the rest of the period, until stop is called.
+//
+// duty must be between 0 and 1. It returns ErrDirection if the pin is an
+// input. The output is left in its last state when stop returns; stop is safe
+// to call more than once. The PWM also stops at the first I²C error, which is
+// then returned by stop.
+//
+// Each period costs two I²C transactions of 3 bytes each, and the timing
+// depends on the bus speed and on the OS scheduler: at 100kHz, a transaction
+// takes at least 300µs so periods below a few milliseconds aren't realistic.
+// This is only good enough for coarse uses like dimming a LED.
+//
+// The timing uses the Clock set with WithClock.
+func (d *Dev) PWM(index int, duty float64, period time.Duration) (func() error, error) {
+	d.mu.Lock()
+	err := d.checkOutput("PWM", index)
+	d.unlock()
+	if err != nil {
+		return nil, err
+	}
+	if duty < 0 || duty > 1 {
+		return nil, fmt.Errorf("PCF8575.PWM: invalid duty %g", duty)
+	}
+	if period <= 0 {
+		return nil, fmt.Errorf("PCF8575.PWM: invalid period %s", period)
+	}
+	on := time.Duration(duty * float64(period))
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	var failed error
+	go func() {
+		defer close(done)
+		for {
+			for _, s := range [...]struct {
+				l bool
+				d time.Duration
+			}{{true, on}, {false, period - on}} {
+				if s.d <= 0 {
+					continue
+				}
+				if failed = d.WriteOutput(index, s.l); failed != nil {
+					return
+				}
+				select {
+				case <-quit:
+					return
+				case <-d.clock.After(s.d):
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	stop := func() error {
+		once.Do(func() { close(quit) })
+		<-done
+		return failed
+	}
+	return stop, nil
+}
@@ -0,0 +1,36 @@
+// Copyright 2017 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package pcf8575
+
+import (
+	"fmt"
+
+	"periph.io/x/periph/conn/i2c"
+)
+
+// Scan returns the addresses of the PCF8575 found on the bus.
+//
+// The addresses 0x20 to 0x27, as selected by the A0 to A2 pins, are probed
+// with a read, which doesn't change the outputs. Note that any other device
+// answering at these addresses is reported too.
+//
+// An address that doesn't acknowledge is skipped, as reported by the linux I²C
+// drivers with ENXIO or EREMOTEIO. Any other error, and every error on other
+// OSes, aborts the scan and is returned along the addresses found so far. If
+// no address acknowledges, the result is nil and the error is nil.
+func Scan(bus i2c.Bus) ([]uint16, error) {
+	var found []uint16
+	var buf [2]byte
+	for addr := uint16(0x20); addr <= 0x27; addr++ {
+		if err := bus.Tx(addr, nil, buf[:]); err != nil {
+			if isNACK(err) {
+				continue
+			}
+			return found, fmt.Errorf("pcf8575: scan 0x%02x: %w", addr, err)
+		}
+		found = append(found, addr)
+	}
+	return found, nil
+}
@@ -0,0 +1,14 @@
+// Copyright 2017 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package pcf8575
+
+// isNACK returns false, the NACK error of the I²C drivers on this OS is not
+// known so every error is reported as a bus failure.
+func isNACK(err error) bool {
+	return false
+}
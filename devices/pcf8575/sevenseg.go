@@ -0,0 +1,85 @@
+// Copyright 2017 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package pcf8575
+
+import (
+	"fmt"
+
+	"periph.io/x/periph/devices"
+)
+
+// SevenSeg drives a single digit seven-segment display, one pin per segment.
+type SevenSeg struct {
+	p           Expander
+	pins        [8]int
+	commonAnode bool
+	mask        uint16 // All the pins used by the display
+}
+
+// NewSevenSeg returns a seven-segment display connected to p.
+//
+// pins are the pin indexes of the segments A to G then the decimal point. A
+// segment is lit by driving its pin high, or low if commonAnode is true. It
+// doesn't do any I/O.
+//
+// A common cathode display connected directly to a PCF8575 is barely visible
+// since the pins can't source current, see Dev.CanSourceCurrent; use a common
+// anode display or drivers.
+func NewSevenSeg(p Expander, pins [8]int, commonAnode bool) (*SevenSeg, error) {
+	s := &SevenSeg{p: p, pins: pins, commonAnode: commonAnode}
+	for _, i := range pins {
+		if i < 0 || i >= PinCount {
+			return nil, fmt.Errorf("pcf8575: seven-segment pin %w (%d)", ErrPinRange, i)
+		}
+		if s.mask&(1<<uint(i)) != 0 {
+			return nil, fmt.Errorf("pcf8575: seven-segment pin %d used twice", i)
+		}
+		s.mask |= 1 << uint(i)
+	}
+	return s, nil
+}
+
+func (s *SevenSeg) String() string {
+	return fmt.Sprintf("SevenSeg{%s}", s.p)
+}
+
+// Show displays digit, between 0x0 and 0xF, and the decimal point if dp is
+// true, in a single write.
+func (s *SevenSeg) Show(digit byte, dp bool) error {
+	if int(digit) >= len(sevenSegGlyphs) {
+		return fmt.Errorf("pcf8575: invalid seven-segment digit 0x%x", digit)
+	}
+	g := sevenSegGlyphs[digit]
+	if dp {
+		g |= 0x80
+	}
+	return s.segments(g)
+}
+
+// Halt turns all the segments off.
+func (s *SevenSeg) Halt() error {
+	return s.segments(0)
+}
+
+// segments lights the segments set in g, bit 0 being A and bit 7 the decimal
+// point.
+func (s *SevenSeg) segments(g byte) error {
+	var v uint16
+	for b, i := range s.pins {
+		if (g&(1<<uint(b)) != 0) != s.commonAnode {
+			v |= 1 << uint(i)
+		}
+	}
+	return s.p.WriteMask(s.mask, v)
+}
+
+// sevenSegGlyphs are the segments of the digits 0 to F, bit 0 being A and bit
+// 6 being G.
+var sevenSegGlyphs = [16]byte{
+	0x3F, 0x06, 0x5B, 0x4F, 0x66, 0x6D, 0x7D, 0x07,
+	0x7F, 0x6F, 0x77, 0x7C, 0x39, 0x5E, 0x79, 0x71,
+}
+
+var _ devices.Device = &SevenSeg{}
@@ -0,0 +1,244 @@
+// Copyright 2017 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Specification
+//
+// http://www.nxp.com/documents/user_manual/UM10204.pdf
+
+package pcf8575
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"periph.io/x/periph/conn/i2c"
+	"periph.io/x/periph/devices/internal/pcf857x"
+)
+
+// SoftI2C is an I²C master bit-banged over two pins of a PCF8575.
+//
+// The pins are quasi-bidirectional, which is exactly what I²C needs: a line
+// latched high is released and pulled up by the weak internal pull-up, a line
+// latched low is driven low. External pull-ups are still recommended.
+//
+// Each change of a line is one I²C transaction on the expander's bus, so a
+// 100kHz bus leads to a clock of at most a few hundred hertz. This is only
+// suitable for very slow peripherals that tolerate the irregular timing. Clock
+// stretching is not supported.
+type SoftI2C struct {
+	d         *Dev
+	scl, sda  int
+	halfCycle time.Duration // Protected by d.mu
+}
+
+// SoftI2C returns an I²C bus bit-banged over the pins sclIndex and sdaIndex.
+//
+// Both lines are released. The pins shouldn't be used for anything else while
+// the bus is in use.
+func (d *Dev) SoftI2C(sclIndex, sdaIndex int) (*SoftI2C, error) {
+	for _, i := range []int{sclIndex, sdaIndex} {
+		if !d.port.Valid(i) {
+			return nil, fmt.Errorf("PCF8575.SoftI2C: %w (%d)", ErrPinRange, i)
+		}
+	}
+	if sclIndex == sdaIndex {
+		return nil, errors.New("PCF8575.SoftI2C: SCL and SDA must be different pins")
+	}
+	s := &SoftI2C{d: d, scl: sclIndex, sda: sdaIndex}
+	d.mu.Lock()
+	defer d.unlock()
+	if err := s.set(s.sda, true); err != nil {
+		return nil, err
+	}
+	if err := s.set(s.scl, true); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SoftI2C) String() string {
+	return fmt.Sprintf("SoftI2C{%s, %s, %s}", s.d, s.d.pins[s.scl], s.d.pins[s.sda])
+}
+
+// Tx implements i2c.Bus.
+//
+// The write, if any, is followed by a repeated start and the read, if any.
+// Only 7 bits addresses are supported.
+func (s *SoftI2C) Tx(addr uint16, w, r []byte) error {
+	if addr > 0x7f {
+		return fmt.Errorf("pcf8575: soft I²C: invalid address 0x%x", addr)
+	}
+	s.d.mu.Lock()
+	defer s.d.unlock()
+	err := s.tx(byte(addr), w, r)
+	if err1 := s.stop(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+// SetSpeed implements i2c.Bus.
+//
+// The speed is an upper bound, the actual speed is limited by the expander's
+// bus. The default is to go as fast as the expander's bus permits.
+func (s *SoftI2C) SetSpeed(hz int64) error {
+	if hz <= 0 {
+		return fmt.Errorf("pcf8575: soft I²C: invalid speed %d", hz)
+	}
+	s.d.mu.Lock()
+	defer s.d.unlock()
+	s.halfCycle = time.Second / time.Duration(hz) / 2
+	return nil
+}
+
+//
+
+func (s *SoftI2C) tx(addr byte, w, r []byte) error {
+	if len(w) != 0 || len(r) == 0 {
+		if err := s.start(); err != nil {
+			return err
+		}
+		if err := s.writeByte(addr << 1); err != nil {
+			return err
+		}
+		for _, b := range w {
+			if err := s.writeByte(b); err != nil {
+				return err
+			}
+		}
+	}
+	if len(r) != 0 {
+		if err := s.start(); err != nil {
+			return err
+		}
+		if err := s.writeByte(addr<<1 | 1); err != nil {
+			return err
+		}
+		for i := range r {
+			var err error
+			if r[i], err = s.readByte(i != len(r)-1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// start sends a start or a repeated start condition.
+//
+// Ends with SDA and SCL low.
+func (s *SoftI2C) start() error {
+	// Page 9, section 3.1.4 START and STOP conditions
+	for _, l := range [...]struct {
+		i    int
+		high bool
+	}{{s.sda, true}, {s.scl, true}, {s.sda, false}, {s.scl, false}} {
+		if err := s.set(l.i, l.high); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stop sends a stop condition.
+//
+// Ends with SDA and SCL released.
+func (s *SoftI2C) stop() error {
+	if err := s.set(s.scl, false); err != nil {
+		return err
+	}
+	if err := s.set(s.sda, false); err != nil {
+		return err
+	}
+	if err := s.set(s.scl, true); err != nil {
+		return err
+	}
+	return s.set(s.sda, true)
+}
+
+// writeByte writes 8 bits, MSB first, and checks the ACK.
+func (s *SoftI2C) writeByte(b byte) error {
+	for x := 7; x >= 0; x-- {
+		if err := s.writeBit(b&(1<<uint(x)) != 0); err != nil {
+			return err
+		}
+	}
+	nack, err := s.readBit()
+	if err != nil {
+		return err
+	}
+	if nack {
+		return errors.New("pcf8575: soft I²C: got NACK")
+	}
+	return nil
+}
+
+// readByte reads 8 bits, MSB first, and sends an ACK if ack is true or a NACK
+// otherwise.
+func (s *SoftI2C) readByte(ack bool) (byte, error) {
+	var b byte
+	for x := 0; x < 8; x++ {
+		l, err := s.readBit()
+		if err != nil {
+			return 0, err
+		}
+		b <<= 1
+		if l {
+			b |= 1
+		}
+	}
+	return b, s.writeBit(!ack)
+}
+
+// writeBit sets SDA then pulses SCL.
+//
+// Expects and ends with SCL low.
+func (s *SoftI2C) writeBit(l bool) error {
+	if err := s.set(s.sda, l); err != nil {
+		return err
+	}
+	if err := s.set(s.scl, true); err != nil {
+		return err
+	}
+	return s.set(s.scl, false)
+}
+
+// readBit releases SDA and samples it while SCL is high.
+//
+// Expects and ends with SCL low.
+func (s *SoftI2C) readBit() (bool, error) {
+	if err := s.set(s.sda, true); err != nil {
+		return false, err
+	}
+	if err := s.set(s.scl, true); err != nil {
+		return false, err
+	}
+	b, err := s.d.readState(context.Background())
+	if err != nil {
+		return false, err
+	}
+	return pcf857x.GetBit(b[s.sda/8], s.sda%8), s.set(s.scl, false)
+}
+
+// set latches the pin at index physically high or low immediately, then
+// waits for half a cycle.
+//
+// d.mu must be held.
+func (s *SoftI2C) set(index int, high bool) error {
+	if s.d.latchedHigh(index) == high {
+		return nil
+	}
+	s.d.setWire(index, high)
+	if err := s.d.updateState(context.Background()); err != nil {
+		return err
+	}
+	if s.halfCycle != 0 {
+		time.Sleep(s.halfCycle)
+	}
+	return nil
+}
+
+var _ i2c.Bus = &SoftI2C{}
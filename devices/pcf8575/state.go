@@ -0,0 +1,151 @@
+// Copyright 2017 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package pcf8575
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// State is the configuration of a Dev, as returned by Dev.State and restored
+// by Dev.Restore, e.g. to be saved in a configuration file.
+//
+// The words have the same bit ordering as Dev.WriteAll.
+//
+// It is encoded in JSON as a version and the list of the pins:
+//
+//	{
+//	  "version": 1,
+//	  "pins": [
+//	    {"index": 0, "name": "LED", "output": false, "input": false, "inverted": true},
+//	    {"index": 3, "name": "", "output": true, "input": true, "inverted": false}
+//	  ]
+//	}
+//
+// "output" is the output latch, taking "inverted" into account, "input" is the
+// direction set with Dev.SetDirection and an empty "name" is the default name.
+// The pins can be listed in any order; the pins not listed and the fields not
+// set keep their power-on state: output high, not input, not inverted and the
+// default name. The fields of version 1 won't change, a new field bumps the
+// version.
+type State struct {
+	Output    uint16           // Output latch, like Dev.ReadOutput
+	InputPins uint16           // Pins set as input with Dev.SetDirection
+	Inverted  uint16           // Pins set as inverted with Dev.SetInverted
+	Names     [PinCount]string // Aliases set with Dev.SetNames
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s State) MarshalJSON() ([]byte, error) {
+	j := jsonState{Version: jsonVersion, Pins: make([]jsonPin, PinCount)}
+	for i := range j.Pins {
+		m := uint16(1) << uint(i)
+		out := s.Output&m != 0
+		j.Pins[i] = jsonPin{
+			Index:    i,
+			Name:     s.Names[i],
+			Output:   &out,
+			Input:    s.InputPins&m != 0,
+			Inverted: s.Inverted&m != 0,
+		}
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+//
+// It doesn't do any I/O.
+func (s *State) UnmarshalJSON(b []byte) error {
+	var j jsonState
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	if j.Version != jsonVersion {
+		return fmt.Errorf("pcf8575: unsupported state version %d", j.Version)
+	}
+	st := State{Output: 0xffff}
+	var seen uint16
+	for _, p := range j.Pins {
+		if p.Index < 0 || p.Index >= PinCount {
+			return fmt.Errorf("pcf8575: state %w (%d)", ErrPinRange, p.Index)
+		}
+		m := uint16(1) << uint(p.Index)
+		if seen&m != 0 {
+			return fmt.Errorf("pcf8575: state pin %d listed twice", p.Index)
+		}
+		seen |= m
+		if p.Output != nil && !*p.Output {
+			st.Output &^= m
+		}
+		if p.Input {
+			st.InputPins |= m
+		}
+		if p.Inverted {
+			st.Inverted |= m
+		}
+		st.Names[p.Index] = p.Name
+	}
+	*s = st
+	return nil
+}
+
+// State returns the configuration of the Dev without doing any I/O.
+func (d *Dev) State() State {
+	d.mu.Lock()
+	defer d.unlock()
+	st := State{
+		Output:    d.port.Word() ^ d.inverted,
+		InputPins: d.inputs,
+		Inverted:  d.inverted,
+	}
+	d.nameMu.Lock()
+	st.Names = d.names
+	d.nameMu.Unlock()
+	return st
+}
+
+// Restore sets the configuration of the Dev to st without doing any I/O.
+//
+// The pins are registered again in gpioreg with their new names, as with
+// SetNames. The outputs are written by the next write, e.g. Flush or
+// SetState(d.GetState()).
+func (d *Dev) Restore(st State) error {
+	names := make(map[int]string, PinCount)
+	for i, n := range st.Names {
+		names[i] = n
+	}
+	if err := d.SetNames(names); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.unlock()
+	d.inverted = st.Inverted
+	d.inputs = st.InputPins
+	d.port.SetWord(st.Output ^ st.Inverted)
+	// The device doesn't match the cache anymore.
+	d.dirty = true
+	return nil
+}
+
+//
+
+// jsonVersion is the version of the JSON encoding of State.
+const jsonVersion = 1
+
+type jsonState struct {
+	Version int       `json:"version"`
+	Pins    []jsonPin `json:"pins"`
+}
+
+type jsonPin struct {
+	Index    int    `json:"index"`
+	Name     string `json:"name"`
+	Output   *bool  `json:"output,omitempty"`
+	Input    bool   `json:"input"`
+	Inverted bool   `json:"inverted"`
+}
+
+var _ json.Marshaler = State{}
+var _ json.Unmarshaler = &State{}
@@ -0,0 +1,142 @@
+// Copyright 2017 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package pcf8575
+
+import (
+	"fmt"
+	"time"
+
+	"periph.io/x/periph/devices"
+)
+
+// Direction is the rotation direction of a Stepper.
+type Direction int
+
+// Valid Direction.
+const (
+	Forward  Direction = 1
+	Backward Direction = -1
+)
+
+// StepMode is the sequence used to drive the coils of a Stepper.
+type StepMode int
+
+// Valid StepMode.
+const (
+	// FullStep energizes two coils at a time, for the highest torque.
+	FullStep StepMode = iota
+	// HalfStep alternates between one and two coils, doubling the resolution;
+	// a 28BYJ-48 has 4096 half steps per revolution.
+	HalfStep
+)
+
+// Stepper drives a unipolar stepper motor, e.g. a 28BYJ-48, through a
+// ULN2003 darlington array connected to four pins.
+//
+// A coil is energized when its pin is latched high. The weak pull-up of a
+// PCF8575 pin latched high can't turn on a ULN2003 input, see
+// Dev.CanSourceCurrent: add a pull-up resistor, e.g. 4.7kΩ, on each input.
+type Stepper struct {
+	p     Expander
+	pins  [4]int
+	mask  uint16
+	seq   []uint8
+	phase int // Current index in seq
+	clock Clock
+}
+
+var (
+	fullStep = []uint8{0x3, 0x6, 0xc, 0x9}
+	halfStep = []uint8{0x1, 0x3, 0x2, 0x6, 0x4, 0xc, 0x8, 0x9}
+)
+
+// NewStepper returns a Stepper whose coils IN1 to IN4 are connected to pins.
+//
+// It doesn't do any I/O, the coils are energized on the first step.
+func NewStepper(p Expander, pins [4]int, mode StepMode) (*Stepper, error) {
+	s := &Stepper{p: p, pins: pins, clock: wallClock{}}
+	switch mode {
+	case FullStep:
+		s.seq = fullStep
+	case HalfStep:
+		s.seq = halfStep
+	default:
+		return nil, fmt.Errorf("pcf8575: invalid step mode %d", mode)
+	}
+	for _, i := range pins {
+		if i < 0 || i >= PinCount {
+			return nil, fmt.Errorf("pcf8575: stepper pin %w (%d)", ErrPinRange, i)
+		}
+		if s.mask&(1<<uint(i)) != 0 {
+			return nil, fmt.Errorf("pcf8575: stepper pin %d used twice", i)
+		}
+		s.mask |= 1 << uint(i)
+	}
+	return s, nil
+}
+
+// SetClock sets the Clock used to time the steps, the wall clock by default,
+// e.g. a fake clock in tests.
+func (s *Stepper) SetClock(c Clock) {
+	s.clock = c
+}
+
+func (s *Stepper) String() string {
+	return fmt.Sprintf("Stepper{%s}", s.p)
+}
+
+// Halt implements devices.Device by releasing the coils.
+func (s *Stepper) Halt() error {
+	return s.Release()
+}
+
+// Step moves the motor n steps in the direction dir, a negative n reversing
+// the direction.
+//
+// Each step updates the four coils in a single I²C transaction, delay is the
+// period between steps including the time taken by the transaction. The
+// coils are left energized to hold the position, see Release.
+func (s *Stepper) Step(n int, dir Direction, delay time.Duration) error {
+	if dir != Forward && dir != Backward {
+		return fmt.Errorf("pcf8575: invalid direction %d", dir)
+	}
+	d := int(dir)
+	if n < 0 {
+		n, d = -n, -d
+	}
+	for i := 0; i < n; i++ {
+		start := s.clock.Now()
+		s.phase = (s.phase + d + len(s.seq)) % len(s.seq)
+		if err := s.p.WriteMask(s.mask, s.coils(s.seq[s.phase])); err != nil {
+			return err
+		}
+		if i != n-1 {
+			if w := delay - s.clock.Now().Sub(start); w > 0 {
+				s.clock.Sleep(w)
+			}
+		}
+	}
+	return nil
+}
+
+// Release de-energizes the coils so the motor doesn't draw current anymore.
+//
+// The motor doesn't hold its position afterward.
+func (s *Stepper) Release() error {
+	return s.p.WriteMask(s.mask, 0)
+}
+
+// coils returns the output state for the coils set in c, bit 0 being IN1.
+func (s *Stepper) coils(c uint8) uint16 {
+	var v uint16
+	for i, p := range s.pins {
+		if c&(1<<uint(i)) != 0 {
+			v |= 1 << uint(p)
+		}
+	}
+	return v
+}
+
+var _ devices.Device = &Stepper{}
@@ -0,0 +1,202 @@
+// Copyright 2017 The Periph Authors. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package pcf8575
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"periph.io/x/periph/conn/gpio"
+)
+
+// Event is an input change reported by Watch.
+type Event struct {
+	Index int       // Index of the pin that changed, -1 if Err is set
+	Level bool      // New level of the pin
+	Time  time.Time // Time at which the change was read
+	Err   error     // Bus error that stopped Watch
+}
+
+// Change is a pin level change returned by Diff.
+type Change struct {
+	Index int  // Index of the pin, between 0 (P00) and 15 (P17)
+	Level bool // New level of the pin
+}
+
+// Diff returns the pins whose level differ between prev and next, lowest
+// index first, e.g. two values returned by ReadAll.
+//
+// It returns nil if nothing changed.
+func Diff(prev, next uint16) []Change {
+	var out []Change
+	for d, i := prev^next, 0; d != 0; d, i = d>>1, i+1 {
+		if d&1 != 0 {
+			out = append(out, Change{Index: i, Level: next&(1<<uint(i)) != 0})
+		}
+	}
+	return out
+}
+
+// Watch reports the input changes on the returned channel until ctx is
+// cancelled, at which point the channel is closed.
+//
+// The pins are read with ReadAll, when the INT pin signals a change if
+// WithInterruptPin was used, otherwise periodically at the interval set with
+// WithPollInterval. The mode is chosen once by Watch, the events are the same
+// in both modes. Only the pins that changed since the previous read are
+// reported, lowest index first, and only for the edges set with WatchPin.
+//
+// If a read fails, a last Event with Err set is sent and the channel is
+// closed. Watch shouldn't be used concurrently with WaitForEdge or the
+// gpio.PinIO wrappers' WaitForEdge as they compete for the INT edges.
+func (d *Dev) Watch(ctx context.Context) (<-chan Event, error) {
+	prev, err := d.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan Event, len(d.pins))
+	go func() {
+		defer close(ch)
+		t := time.NewTicker(d.pollInterval)
+		defer t.Stop()
+		send := func(e Event) bool {
+			select {
+			case ch <- e:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		for {
+			if d.intPin != nil {
+				// Wake up regularly to notice ctx being cancelled.
+				if ctx.Err() != nil {
+					return
+				}
+				if !d.intPin.WaitForEdge(d.pollInterval) {
+					continue
+				}
+			} else {
+				select {
+				case <-ctx.Done():
+					return
+				case <-t.C:
+				}
+			}
+			v, err := d.ReadAll()
+			now := time.Now()
+			if err != nil {
+				send(Event{Index: -1, Time: now, Err: err})
+				return
+			}
+			d.mu.Lock()
+			rising, falling := d.watchRising, d.watchFalling
+			d.unlock()
+			for _, c := range Diff(prev, v) {
+				m := uint16(1) << uint(c.Index)
+				if c.Level && rising&m == 0 || !c.Level && falling&m == 0 {
+					continue
+				}
+				if !send(Event{Index: c.Index, Level: c.Level, Time: now}) {
+					return
+				}
+			}
+			prev = v
+		}
+	}()
+	return ch, nil
+}
+
+// WatchPin sets the edges of the pin at index reported by Watch, and thus
+// OnChange, e.g. gpio.FallingEdge to only report the presses of a button
+// pulling the pin low.
+//
+// The default is gpio.BothEdges for all the pins, gpio.NoEdge stops reporting
+// the pin. It takes effect on the next read of a running Watch.
+func (d *Dev) WatchPin(index int, edge gpio.Edge) error {
+	d.mu.Lock()
+	defer d.unlock()
+	if !d.port.Valid(index) {
+		return fmt.Errorf("PCF8575.WatchPin: %w (%d)", ErrPinRange, index)
+	}
+	m := uint16(1) << uint(index)
+	d.watchRising &^= m
+	d.watchFalling &^= m
+	if edge == gpio.RisingEdge || edge == gpio.BothEdges {
+		d.watchRising |= m
+	}
+	if edge == gpio.FallingEdge || edge == gpio.BothEdges {
+		d.watchFalling |= m
+	}
+	return nil
+}
+
+// OnChange registers fn to be called with the new level of the pin at index
+// when it changes.
+//
+// The first call starts a goroutine using Watch, shared by all the callbacks
+// and stopped by StopWatching. The callbacks are called from this goroutine
+// in order, without holding any lock, so they can use the Dev. They shouldn't
+// block for long since the changes are not read meanwhile, nor call
+// StopWatching. If a read fails, the goroutine stops and the next call to
+// OnChange starts it again.
+func (d *Dev) OnChange(index int, fn func(level bool)) error {
+	if !d.port.Valid(index) {
+		return fmt.Errorf("PCF8575.OnChange: %w (%d)", ErrPinRange, index)
+	}
+	d.cbMu.Lock()
+	defer d.cbMu.Unlock()
+	if d.watchDone != nil {
+		select {
+		case <-d.watchDone:
+		default:
+			d.callbacks[index] = append(d.callbacks[index], fn)
+			return nil
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := d.Watch(ctx)
+	if err != nil {
+		cancel()
+		return err
+	}
+	// Only register fn once the goroutine can run it, so a retry after an
+	// error doesn't register it twice.
+	d.callbacks[index] = append(d.callbacks[index], fn)
+	done := make(chan struct{})
+	d.stopWatch, d.watchDone = cancel, done
+	go func() {
+		defer close(done)
+		for e := range ch {
+			if e.Err != nil {
+				return
+			}
+			d.cbMu.Lock()
+			cbs := d.callbacks[e.Index]
+			d.cbMu.Unlock()
+			for _, cb := range cbs {
+				cb(e.Level)
+			}
+		}
+	}()
+	return nil
+}
+
+// StopWatching stops the goroutine started by OnChange and removes all the
+// callbacks.
+//
+// It returns once no callback is running anymore.
+func (d *Dev) StopWatching() {
+	d.cbMu.Lock()
+	stop, done := d.stopWatch, d.watchDone
+	d.stopWatch, d.watchDone = nil, nil
+	d.callbacks = [PinCount][]func(bool){}
+	d.cbMu.Unlock()
+	if stop != nil {
+		stop()
+		<-done
+	}
+}